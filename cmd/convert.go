@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	convertTo       string
+	convertComments bool
+	convertCmd      = &cobra.Command{
+		Use:   "convert",
+		Short: "Convert a topology between the topology.conf and topology.yaml formats",
+		Long: "Write a topology.conf file as a topology.yaml file of one cluster default topology,\n" +
+			"named by --topology-name, or write the --topology-name or --partition topology of a\n" +
+			"topology.yaml file as a topology.conf file. Switches are written leaves first, then\n" +
+			"by level, with compressed hostlists.",
+		Example: "  topology convert -p topology.conf --topology-name cpu > topology.yaml\n" +
+			"  topology convert -p topology.yaml --partition gpu > topology.conf",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			to := convertTo
+			if to == "" {
+				to = "yaml"
+				if isYAML(topology) {
+					to = "conf"
+				}
+			}
+			if to != "conf" && to != "yaml" {
+				return fmt.Errorf("unknown format %q, expected conf or yaml", to)
+			}
+			cmd.SilenceUsage = true
+
+			var topologies tree.Topologies
+			if isYAML(topology) {
+				var err error
+				topologies, err = tree.LoadYAML(topology, pluginOptions()...)
+				if err != nil {
+					return err
+				}
+				/* Keep all the topologies, unless one is asked for */
+				if to == "conf" || topologyName != "" || partition != "" {
+					nt, err := findTopology(topology, topologies)
+					if err != nil {
+						return err
+					}
+					topologies = tree.Topologies{{Name: nt.Name, ClusterDefault: true, Topology: nt.Topology}}
+				}
+			} else {
+				topo, err := tree.Load(topology, pluginOptions()...)
+				if err != nil {
+					return err
+				}
+				name := topologyName
+				if name == "" {
+					name = strings.TrimSuffix(filepath.Base(topology), filepath.Ext(topology))
+				}
+				topologies = tree.Topologies{{Name: name, ClusterDefault: true, Topology: topo}}
+			}
+
+			if to == "yaml" {
+				return topologies.WriteYAML(cmd.OutOrStdout())
+			}
+			opts := []tree.WriteOption{}
+			if convertComments {
+				opts = append(opts, tree.WithComments())
+			}
+			return topologies[0].Topology.WriteConfig(cmd.OutOrStdout(), opts...)
+		},
+	}
+)
+
+func init() {
+	addTopologyFlags(convertCmd)
+	convertCmd.Flags().StringVar(&convertTo, "to", "", "Output format, conf or yaml (default: the other format than the input)")
+	convertCmd.Flags().BoolVar(&convertComments, "comments", false, "Describe each level of switches in comments of a topology.conf")
+	rootCmd.AddCommand(convertCmd)
+}
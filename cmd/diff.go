@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/diff"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	diffOutput string
+	diffCmd    = &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "Compare the switch records of two topology configurations",
+		Long: "Compare the loaded switch records, not the text, of two topology configurations:\n" +
+			"added and removed switches and nodes, nodes that moved between leaf switches, and\n" +
+			"changes of the parents, level or LinkSpeed of switches.\n\n" +
+			"As diff(1), the exit status is 0 if the topologies are the same, 1 if they differ\n" +
+			"and 2 on errors.",
+		Example: "  topology diff topology.conf topology.conf.new\n" +
+			"  topology diff -o json topology.yaml topology.conf --topology-name cpu",
+		Args: func(cmd *cobra.Command, args []string) error {
+			return usageError(cmd, cobra.ExactArgs(2)(cmd, args))
+		},
+		/* Before cobra validates them, so that the error exits 2 */
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return usageError(cmd, cmd.ValidateFlagGroups())
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if diffOutput != "" && diffOutput != "json" {
+				return usageError(cmd, fmt.Errorf("unknown output format %q, expected json", diffOutput))
+			}
+			cmd.SilenceUsage = true
+
+			if (topologyName != "" || partition != "") && !isYAML(args[0]) && !isYAML(args[1]) {
+				return usageError(cmd, errors.New("--topology-name and --partition require a topology.yaml file"))
+			}
+			before, err := loadDiffTopology(args[0])
+			if err != nil {
+				return &codeError{code: 2, err: err}
+			}
+			after, err := loadDiffTopology(args[1])
+			if err != nil {
+				return &codeError{code: 2, err: err}
+			}
+
+			d := diff.Compare(before, after)
+			if diffOutput == "json" {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				err = enc.Encode(d)
+			} else {
+				err = diff.WriteText(cmd.OutOrStdout(), d)
+			}
+			if err != nil {
+				return &codeError{code: 2, err: err}
+			}
+			if !d.Equal {
+				return &codeError{code: 1, err: errors.New("topologies differ")}
+			}
+			return nil
+		},
+	}
+)
+
+// loadDiffTopology loads a configuration to compare, the --topology-name or
+// --partition topology applying to topology.yaml files only.
+func loadDiffTopology(path string) (*tree.Topology, error) {
+	if !isYAML(path) {
+		return tree.Load(path, pluginOptions()...)
+	}
+	return loadTopologyFile(path, pluginOptions()...)
+}
+
+func init() {
+	diffCmd.Flags().StringVar(&plugin, "plugin", "", "Topology plugin, tree or block (default: block if the configuration has BlockName lines)")
+	diffCmd.Flags().StringVar(&topologyName, "topology-name", "", "Topology of topology.yaml files to compare (default: the cluster default topology)")
+	diffCmd.Flags().StringVar(&partition, "partition", "", "Compare the topologies of a partition, as set by the slurm.conf next to topology.yaml files")
+	diffCmd.MarkFlagsMutuallyExclusive("topology-name", "partition")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "Write the differences as json")
+	diffCmd.SetFlagErrorFunc(usageError)
+	usageExitCodes[diffCmd] = 2
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+/* Run the topology command with args and return its exit status */
+func _run(t *testing.T, args ...string) int {
+	t.Helper()
+	/* Flags keep their values and Changed state between executions */
+	for _, cmd := range []*pflag.FlagSet{rootCmd.PersistentFlags(), diffCmd.Flags()} {
+		cmd.VisitAll(func(f *pflag.Flag) {
+			require.NoError(t, f.Value.Set(f.DefValue))
+			f.Changed = false
+		})
+	}
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetErr(&out)
+	rootCmd.SetArgs(args)
+	err := rootCmd.Execute()
+	if err == nil {
+		return 0
+	}
+	return exitCode(err)
+}
+
+func TestDiff_exitCode(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{"diff", "../test/topology1.conf", "../test/topology1.conf"}, 0},
+		{[]string{"diff", "-o", "json", "../test/topology2.conf", "../test/topology.yaml"}, 1},
+		{[]string{"diff", "../test/topology1.conf", "../test/topology2.conf"}, 1},
+		/* Errors exit 2, not as differences */
+		{[]string{"diff", "../test/topology1.conf", "../test/missing.conf"}, 2},
+		{[]string{"diff", "../test/topology1.conf"}, 2},
+		{[]string{"diff", "--bogus", "../test/topology1.conf", "../test/topology2.conf"}, 2},
+		{[]string{"diff", "-o", "yaml", "../test/topology1.conf", "../test/topology2.conf"}, 2},
+		{[]string{"diff", "--log-level", "loud", "../test/topology1.conf", "../test/topology2.conf"}, 2},
+		{[]string{"diff", "--topology-name", "cpu", "--partition", "gpu", "../test/topology.yaml", "../test/topology2.conf"}, 2},
+		{[]string{"diff", "--topology-name", "cpu", "../test/topology1.conf", "../test/topology2.conf"}, 2},
+		{[]string{"diff", "--topology-name", "login", "../test/topology.yaml", "../test/topology2.conf"}, 2},
+	} {
+		require.Equal(t, tc.code, _run(t, tc.args...), tc.args)
+	}
+
+	/* Other commands keep exiting 1 on usage errors */
+	require.Equal(t, 1, _run(t, "validate", "--log-level", "loud", "-p", "../test/topology1.conf"))
+}
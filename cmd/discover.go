@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/discover/ib"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	noComments  bool
+	discoverOut string
+	discoverCmd = &cobra.Command{
+		Use:   "discover",
+		Short: "Generate a topology configuration from a network discovery",
+	}
+	discoverIBCmd = &cobra.Command{
+		Use:   "ib [FILE]",
+		Short: "Generate a topology.conf from the output of ibnetdiscover -S -p",
+		Long: "Generate a topology.conf from the output of ibnetdiscover -S -p, read from FILE or\n" +
+			"standard input, as slurmibtopology.sh does. Switches are named ibswN in discovery\n" +
+			"order; inactive links and links to aggregation nodes are skipped.",
+		Example: "  ibnetdiscover -S -p | topology discover ib -o topology.conf",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+
+			var r io.Reader = cmd.InOrStdin()
+			if len(args) == 1 && args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				r = file
+			}
+			fabric, err := ib.Parse(r)
+			if err != nil {
+				return err
+			}
+			/* Only write a topology Slurm can load */
+			if _, err := fabric.Topology(tree.WithStrict()); err != nil {
+				return err
+			}
+
+			if discoverOut == "" {
+				return fabric.WriteTopologyConf(cmd.OutOrStdout(), !noComments)
+			}
+			file, err := os.Create(discoverOut)
+			if err != nil {
+				return err
+			}
+			if err := fabric.WriteTopologyConf(file, !noComments); err != nil {
+				file.Close()
+				return err
+			}
+			return file.Close()
+		},
+	}
+)
+
+func init() {
+	discoverIBCmd.Flags().BoolVarP(&noComments, "no-comments", "c", false, "Do not describe the switches and their links in comments")
+	discoverIBCmd.Flags().StringVarP(&discoverOut, "output", "o", "", "Write the topology.conf to a file instead of standard output")
+	discoverCmd.AddCommand(discoverIBCmd)
+	rootCmd.AddCommand(discoverCmd)
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// describeCandidate tells how a candidate leaf switch compared to the best
+// candidate so far.
+func describeCandidate(c tree.TraceCandidate) string {
+	var desc string
+	switch {
+	case c.Best == "" && c.Preferred:
+		desc = "first possibility"
+	case c.Best == "" && c.Unreachable:
+		return "unreachable"
+	case c.Best == "":
+		return "no nodes"
+	case c.Fit > 0:
+		desc = "fits better than " + c.Best
+	case c.Fit < 0:
+		desc = "fits worse than " + c.Best
+	case c.Preferred:
+		/* Same fit, the switch won on distance */
+		desc = "fits as well as " + c.Best + " and is closer"
+	default:
+		desc = "fits as well as " + c.Best
+	}
+	if c.Preferred {
+		desc += ", best so far"
+	}
+	return desc
+}
+
+// writeTrace writes the decisions of a selection to w in a readable form.
+func writeTrace(w io.Writer, trace *tree.Trace) error {
+	if trace.TopSwitch != "" {
+		fmt.Fprintf(w, "Top switch %s: %s\n", trace.TopSwitch, trace.TopSwitchReason)
+	}
+	for i, step := range trace.Steps {
+		fmt.Fprintf(w, "Round %d, %d nodes remaining:\n", i+1, step.RemainingNodes)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, c := range step.Candidates {
+			distance := fmt.Sprint(c.Distance)
+			if c.Unreachable {
+				distance = "-"
+			}
+			fmt.Fprintf(tw, "  %s\tdistance %s\tnodes %d\t%s\n",
+				c.Switch, distance, c.NodeCount, describeCandidate(c))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		if step.Chosen != "" {
+			fmt.Fprintf(w, "  chose %s\n", step.Chosen)
+		}
+	}
+	_, err := fmt.Fprintf(w, "Stopped: %s\n", trace.StopReason)
+	return err
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/export"
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	exportFormat string
+	highlight    []string
+	exportCmd    = &cobra.Command{
+		Use:   "export",
+		Short: "Draw the switch hierarchy or the blocks of a topology as a DOT or Mermaid graph",
+		Long: "Draw the switches of a topology by level, the edges to their child switches labelled\n" +
+			"with LinkSpeed, and the nodes of each leaf switch as hostlists. --highlight highlights\n" +
+			"nodes and the switches above them; -c highlights the nodes selected for a job among\n" +
+			"the -a available nodes, under the top switch of the selection.",
+		Example: "  topology export -p topology.conf | dot -Tsvg > topology.svg\n" +
+			"  topology export -p topology.conf -f mermaid -a 'tux[0-15]' -c 6",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writers := map[string]func(w io.Writer, topo *tree.Topology, sel *tree.Selection) error{
+				"dot":     export.WriteDOT,
+				"mermaid": export.WriteMermaid,
+			}
+			write, ok := writers[exportFormat]
+			if !ok {
+				return fmt.Errorf("unknown format %q, expected dot or mermaid", exportFormat)
+			}
+			if len(highlight) > 0 && requested > 0 {
+				return errors.New("--highlight and --requested-node-count are mutually exclusive")
+			}
+			cmd.SilenceUsage = true
+
+			var topo *tree.Topology
+			var sel *tree.Selection
+			var err error
+			if requested > 0 {
+				topo, sel, err = selectNodes(nil)
+			} else {
+				topo, err = loadTopology(pluginOptions()...)
+			}
+			if err != nil {
+				return err
+			}
+			if len(highlight) > 0 {
+				nodes, err := hostlist.ExpandAll(highlight)
+				if err != nil {
+					return err
+				}
+				sel = &tree.Selection{Nodes: nodes}
+			}
+			return write(cmd.OutOrStdout(), topo, sel)
+		},
+	}
+)
+
+func init() {
+	addTopologyFlags(exportCmd)
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "dot", "Graph format: dot or mermaid")
+	exportCmd.Flags().StringArrayVar(&highlight, "highlight", []string{}, "Nodes to highlight, as hostlist expressions")
+	exportCmd.Flags().StringArrayVarP(&availableNodes, "available-nodes", "a", []string{}, "List of available nodes of the selection to highlight, as hostlist expressions")
+	exportCmd.Flags().StringArrayVarP(&requiredNodes, "required-nodes", "r", []string{}, "List of required nodes of the selection to highlight, as hostlist expressions")
+	exportCmd.Flags().Uint32VarP(&requested, "requested-node-count", "c", 0, "Number of nodes of the selection to highlight")
+	rootCmd.AddCommand(exportCmd)
+}
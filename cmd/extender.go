@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/extender"
+	"github.com/yeahdongcn/topology/pkg/server"
+)
+
+var (
+	extenderConfig extender.Config
+	extenderCmd    = &cobra.Command{
+		Use:   "extender",
+		Short: "Run a kube-scheduler extender placing pod groups on the fewest leaf switches",
+		Long: "Run a kube-scheduler extender implementing the filter and prioritize verbs.\n\n" +
+			"Filter drops the nodes that are not in the topology or not connected to the\n" +
+			"nodes of the pod group. Prioritize scores nodes by leaf switch locality to the\n" +
+			"nodes the tree evaluator selects for the group.",
+		RunE: runExtender,
+	}
+)
+
+func init() {
+	addTopologyFlags(extenderCmd)
+	extenderCmd.Flags().StringVar(&listenAddress, "listen", ":8888", "Address to listen on")
+	extenderCmd.Flags().BoolVar(&dragonfly, "dragonfly", false, "Optimize the allocation for a dragonfly network (TopologyParam=Dragonfly)")
+	extenderCmd.Flags().StringVarP(&weightsFile, "weights", "w", "", "Read node scheduling weights and order from the NodeName lines of a slurm.conf file")
+	extenderCmd.Flags().StringVar(&extenderConfig.NodeNameLabel, "node-name-label", "", "Node label holding the topology node name (default: the node name, or its short name)")
+	extenderCmd.Flags().StringVar(&extenderConfig.NodeCountAnnotation, "node-count-annotation", extender.DefaultNodeCountAnnotation, "Pod annotation holding the number of nodes of the pod group")
+	rootCmd.AddCommand(extenderCmd)
+}
+
+func runExtender(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	opts, err := loadOptions()
+	if err != nil {
+		return err
+	}
+	topo, err := loadTopology(opts...)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return err
+	}
+	log.Info("Listening on ", l.Addr())
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return server.Serve(ctx, l, extender.New(topo, extenderConfig))
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+var hostlistCmd = &cobra.Command{
+	Use:   "hostlist NAMES...",
+	Short: "Print host names as a sorted hostlist expression, as scontrol show hostlistsorted does",
+	Example: "  topology hostlist tux5,tux4 tux6 'tux[12-15]'\n" +
+		"  topology hostlist worker001,worker003,worker002",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		names, err := hostlist.ExpandAll(args)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), hostlist.Compress(names))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hostlistCmd)
+}
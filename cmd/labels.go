@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/labels"
+)
+
+var (
+	labelKeys   []string
+	labelFormat string
+	labelsCmd   = &cobra.Command{
+		Use:   "labels",
+		Short: "Generate Kubernetes node labels naming the switch of each level above a node",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writers := map[string]func(w io.Writer, nodes []labels.NodeLabels) error{
+				"kubectl":    labels.WriteKubectl,
+				"json-patch": labels.WriteJSONPatch,
+				"manifest":   labels.WriteManifests,
+			}
+			write, ok := writers[labelFormat]
+			if !ok {
+				return fmt.Errorf("unknown format %q, expected kubectl, json-patch or manifest", labelFormat)
+			}
+			cmd.SilenceUsage = true
+
+			topo, err := loadTopology(pluginOptions()...)
+			if err != nil {
+				return err
+			}
+			nodes, err := labels.Generate(topo, labelKeys)
+			if err != nil {
+				return err
+			}
+			return write(cmd.OutOrStdout(), nodes)
+		},
+	}
+)
+
+func init() {
+	addTopologyFlags(labelsCmd)
+	labelsCmd.Flags().StringSliceVar(&labelKeys, "keys", labels.DefaultKeys, "Label keys of the switch levels, from the leaf switches up; an empty key skips its level")
+	labelsCmd.Flags().StringVarP(&labelFormat, "format", "f", "kubectl", "Output format: kubectl, json-patch or manifest")
+	rootCmd.AddCommand(labelsCmd)
+}
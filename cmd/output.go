@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yeahdongcn/topology/pkg/result"
+)
+
+// codeError is an error that sets the exit status.
+type codeError struct {
+	code int
+	err  error
+}
+
+func (e *codeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codeError) Unwrap() error {
+	return e.err
+}
+
+// writeSelectResult writes res to w in the given output format.
+func writeSelectResult(w io.Writer, format string, res *result.Select) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "hostlist":
+		if res.ErrorCode != result.CodeSuccess {
+			return nil
+		}
+		if nodeRank {
+			/* A hostlist expression would lose the rank order */
+			_, err := fmt.Fprintln(w, strings.Join(res.Nodes, ","))
+			return err
+		}
+		_, err := fmt.Fprintln(w, res.Hostlist)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q, expected json, yaml or hostlist", format)
+}
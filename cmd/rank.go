@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+var (
+	slurmConf bool
+	rankCmd   = &cobra.Command{
+		Use:   "rank",
+		Short: "Print the rank of each node, as TopologyParam=SwitchAsNodeRank assigns",
+		/* Configuration problems are not usage errors */
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			topo, err := loadTopology(pluginOptions()...)
+			if err != nil {
+				return err
+			}
+
+			ranks := topo.GenerateNodeRanking()
+			nodes := make([]string, 0, len(ranks))
+			for node := range ranks {
+				nodes = append(nodes, node)
+			}
+			slices.SortFunc(nodes, func(a, b string) int {
+				if c := cmp.Compare(ranks[a], ranks[b]); c != 0 {
+					return c
+				}
+				return hostlist.Compare(a, b)
+			})
+
+			if !slurmConf {
+				for _, node := range nodes {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s %d\n", node, ranks[node])
+				}
+				return nil
+			}
+
+			/* One NodeName line per rank, lower ranks are preferred */
+			for start := 0; start < len(nodes); {
+				end := start + 1
+				for end < len(nodes) && ranks[nodes[end]] == ranks[nodes[start]] {
+					end++
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "NodeName=%s Weight=%d\n",
+					hostlist.Compress(nodes[start:end]), ranks[nodes[start]])
+				start = end
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	addTopologyFlags(rankCmd)
+	rankCmd.Flags().BoolVar(&slurmConf, "slurm-conf", false, "Print NodeName=... Weight=... lines for slurm.conf instead")
+	rootCmd.AddCommand(rankCmd)
+}
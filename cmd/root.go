@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -11,47 +14,134 @@ import (
 )
 
 var (
-	topology       string
-	availableNodes []string
-	requiredNodes  []string
-	requested      uint32
-	rootCmd        = &cobra.Command{
-		Use: "topology",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			log.Debugf("Topology configuration file: %s", topology)
-			log.Debugf("Available nodes: %#v", availableNodes)
-			log.Debugf("Required nodes: %#v", requiredNodes)
-			log.Debugf("Number of nodes requested: %d", requested)
-
-			err := tree.SwitchRecordValidate(topology)
+	topology     string
+	plugin       string
+	topologyName string
+	partition    string
+	logLevel     string
+	rootCmd      = &cobra.Command{
+		Use:   "topology",
+		Short: "Select nodes for a job from a Slurm topology configuration",
+		Long: "Select nodes for a job from a Slurm topology configuration.\n\n" +
+			"Without a subcommand, topology behaves as topology select.",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			level, err := log.ParseLevel(logLevel)
 			if err != nil {
-				return err
+				return usageError(cmd, err)
 			}
-			selectedNodes, leafSwitchCount, err := tree.EvalNodesTree(availableNodes, requiredNodes, requested)
-			if err != nil {
-				return err
-			}
-
-			log.Info("Selected nodes: ", selectedNodes)
-			log.Info("Leaf switch count: ", leafSwitchCount)
+			/* Keep stdout for results */
+			log.SetOutput(os.Stderr)
+			log.SetLevel(level)
 			return nil
 		},
+		RunE: runSelect,
+		/* Execute prints the error */
+		SilenceErrors: true,
 	}
 )
 
+// usageExitCodes are the exit statuses of usage errors of the commands that
+// do not exit 1 on them, such as diff which exits as diff(1) does.
+var usageExitCodes = map[*cobra.Command]int{}
+
+// usageError returns err, a usage error of cmd, with the exit status of the
+// usage errors of cmd. It returns nil if err is nil.
+func usageError(cmd *cobra.Command, err error) error {
+	if code, ok := usageExitCodes[cmd]; ok && err != nil {
+		return &codeError{code: code, err: err}
+	}
+	return err
+}
+
 func init() {
-	rootCmd.Flags().StringVarP(&topology, "topology", "p", "", "Path to the topology configuration file")
-	rootCmd.Flags().StringArrayVarP(&availableNodes, "available-nodes", "a", []string{}, "List of available nodes")
-	rootCmd.Flags().StringArrayVarP(&requiredNodes, "required-nodes", "r", []string{}, "List of required nodes")
-	rootCmd.Flags().Uint32VarP(&requested, "requested-node-count", "c", 0, "Number of nodes requested")
-	rootCmd.MarkFlagRequired("topology")
-	rootCmd.MarkFlagRequired("available-nodes")
-	rootCmd.MarkFlagRequired("requested-node-count")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "Log level: panic, fatal, error, warn, info, debug or trace")
+	addTopologyFlags(rootCmd)
+	addSelectFlags(rootCmd)
+}
+
+// addTopologyFlags adds the flags locating and interpreting the topology
+// configuration to cmd. They are not persistent flags, so that the help and
+// completion commands do not require them.
+func addTopologyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&topology, "topology", "p", "", "Path to the topology configuration file")
+	cmd.Flags().StringVar(&plugin, "plugin", "", "Topology plugin, tree or block (default: block if the configuration has BlockName lines)")
+	cmd.Flags().StringVar(&topologyName, "topology-name", "", "Topology of a topology.yaml file to use (default: the cluster default topology)")
+	cmd.Flags().StringVar(&partition, "partition", "", "Use the topology of a partition, as set by the slurm.conf next to a topology.yaml file")
+	cmd.MarkFlagsMutuallyExclusive("topology-name", "partition")
+	cmd.MarkFlagRequired("topology")
+}
+
+// isYAML tells whether path is a topology.yaml file of named topologies
+// rather than a topology.conf file.
+func isYAML(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// loadTopology loads the --topology configuration with opts. Of a
+// topology.yaml file, it loads the --topology-name or --partition topology.
+func loadTopology(opts ...tree.LoadOption) (*tree.Topology, error) {
+	return loadTopologyFile(topology, opts...)
+}
+
+// loadTopologyFile loads the configuration at path as loadTopology does.
+func loadTopologyFile(path string, opts ...tree.LoadOption) (*tree.Topology, error) {
+	if !isYAML(path) {
+		if topologyName != "" || partition != "" {
+			return nil, errors.New("--topology-name and --partition require a topology.yaml file")
+		}
+		return tree.Load(path, opts...)
+	}
+
+	topologies, err := tree.LoadYAML(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	nt, err := findTopology(path, topologies)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("Using topology %s of %s", nt.Name, path)
+	return nt.Topology, nil
+}
+
+// findTopology returns the --topology-name or --partition topology of the
+// topologies of the topology.yaml file at path.
+func findTopology(path string, topologies tree.Topologies) (*tree.NamedTopology, error) {
+	if partition == "" {
+		return topologies.Find(topologyName)
+	}
+	partitions, err := tree.LoadPartitionTopologies(filepath.Join(filepath.Dir(path), "slurm.conf"))
+	if err != nil {
+		return nil, err
+	}
+	return topologies.ForPartition(partitions, partition)
+}
+
+// pluginOptions returns the load options selecting the --plugin topology plugin.
+func pluginOptions() []tree.LoadOption {
+	if plugin == "" {
+		return []tree.LoadOption{}
+	}
+	if !strings.Contains(plugin, "/") {
+		return []tree.LoadOption{tree.WithPlugin("topology/" + plugin)}
+	}
+	return []tree.LoadOption{tree.WithPlugin(plugin)}
 }
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode returns the exit status of a command failing with err: the code
+// of a *codeError, 1 otherwise.
+func exitCode(err error) int {
+	var codeErr *codeError
+	if errors.As(err, &codeErr) {
+		return codeErr.code
 	}
+	return 1
 }
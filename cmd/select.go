@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/result"
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	availableNodes []string
+	requiredNodes  []string
+	requested      uint32
+	dragonfly      bool
+	weightsFile    string
+	nodeRank       bool
+	output         string
+	explain        bool
+	selectCmd      = &cobra.Command{
+		Use:   "select",
+		Short: "Select the nodes of a job with the best topology",
+		RunE:  runSelect,
+	}
+)
+
+func init() {
+	addTopologyFlags(selectCmd)
+	addSelectFlags(selectCmd)
+	rootCmd.AddCommand(selectCmd)
+}
+
+// addSelectFlags adds the flags of the select command to cmd, so the root
+// command can keep selecting nodes.
+func addSelectFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&availableNodes, "available-nodes", "a", []string{}, "List of available nodes, as hostlist expressions")
+	cmd.Flags().StringArrayVarP(&requiredNodes, "required-nodes", "r", []string{}, "List of required nodes, as hostlist expressions")
+	cmd.Flags().Uint32VarP(&requested, "requested-node-count", "c", 0, "Number of nodes requested")
+	cmd.Flags().BoolVar(&dragonfly, "dragonfly", false, "Optimize the allocation for a dragonfly network (TopologyParam=Dragonfly)")
+	cmd.Flags().StringVarP(&weightsFile, "weights", "w", "", "Read node scheduling weights and order from the NodeName lines of a slurm.conf file")
+	cmd.Flags().BoolVar(&nodeRank, "switch-as-node-rank", false, "Select and list nodes by leaf switch rank (TopologyParam=SwitchAsNodeRank)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write the result to stdout as json, yaml or hostlist")
+	cmd.Flags().BoolVar(&explain, "explain", false, "Print the decisions of the selection to stderr")
+	cmd.MarkFlagRequired("available-nodes")
+	cmd.MarkFlagRequired("requested-node-count")
+}
+
+func runSelect(cmd *cobra.Command, args []string) error {
+	/* The arguments are valid, errors from now on are not usage errors */
+	cmd.SilenceUsage = true
+	if output != "" && !slices.Contains([]string{"json", "yaml", "hostlist"}, output) {
+		return fmt.Errorf("unknown output format %q, expected json, yaml or hostlist", output)
+	}
+
+	log.Debugf("Topology configuration file: %s", topology)
+	log.Debugf("Available nodes: %#v", availableNodes)
+	log.Debugf("Required nodes: %#v", requiredNodes)
+	log.Debugf("Number of nodes requested: %d", requested)
+
+	var trace *tree.Trace
+	if explain {
+		trace = &tree.Trace{}
+	}
+	topo, selection, err := selectNodes(trace)
+	if trace != nil && (err == nil || errors.Is(err, tree.ErrEvalFailed)) {
+		if err := writeTrace(cmd.ErrOrStderr(), trace); err != nil {
+			return err
+		}
+	}
+	if output == "" {
+		if err != nil {
+			return err
+		}
+		if nodeRank {
+			/* A hostlist expression would lose the rank order */
+			log.Info("Selected nodes: ", strings.Join(selection.Nodes, ","))
+		} else {
+			log.Info("Selected nodes: ", hostlist.Compress(selection.Nodes))
+		}
+		if topo.Plugin() == tree.PluginBlock {
+			log.Info("Block count: ", selection.LeafSwitchCount())
+		} else {
+			log.Info("Leaf switch count: ", selection.LeafSwitchCount())
+		}
+		return nil
+	}
+
+	var res *result.Select
+	if err == nil {
+		res = result.New(topo, selection)
+	} else {
+		res = result.NewError(err)
+	}
+	if err := writeSelectResult(cmd.OutOrStdout(), output, res); err != nil {
+		return err
+	}
+	if err != nil {
+		return &codeError{code: res.ErrorCode, err: err}
+	}
+	return nil
+}
+
+// selectNodes loads the topology and selects nodes as the flags request,
+// recording the decisions into trace unless it is nil.
+func selectNodes(trace *tree.Trace) (*tree.Topology, *tree.Selection, error) {
+	available, err := hostlist.ExpandAll(availableNodes)
+	if err != nil {
+		return nil, nil, err
+	}
+	required, err := hostlist.ExpandAll(requiredNodes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts, err := loadOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	topo, err := loadTopology(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	evalOpts := []tree.EvalOption{}
+	if trace != nil {
+		evalOpts = append(evalOpts, tree.WithTrace(trace))
+	}
+	selection, err := topo.Eval(available, required, requested, evalOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return topo, selection, nil
+}
+
+// loadOptions returns the options loading a topology as the flags request.
+func loadOptions() ([]tree.LoadOption, error) {
+	opts := pluginOptions()
+	if dragonfly {
+		opts = append(opts, tree.WithDragonfly())
+	}
+	if nodeRank {
+		opts = append(opts, tree.WithSwitchAsNodeRank())
+	}
+	if weightsFile != "" {
+		weights, err := tree.LoadNodeWeights(weightsFile)
+		if err != nil {
+			return nil, err
+		}
+		order, err := tree.LoadNodeOrder(weightsFile)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, tree.WithNodeWeights(weights), tree.WithNodeOrder(order))
+	}
+	return opts, nil
+}
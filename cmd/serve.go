@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/server"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	serveTopologies []string
+	listenAddress   string
+	serveCmd        = &cobra.Command{
+		Use:   "serve",
+		Short: "Answer select, validate, show and distance queries over HTTP",
+		Long: "Load topologies once and answer queries over HTTP with JSON documents:\n\n" +
+			"  GET  /healthz\n" +
+			"  POST /v1/select    {\"topology\", \"partition\", \"available_nodes\", \"required_nodes\", \"requested_node_count\", \"explain\"}\n" +
+			"  GET  /v1/validate?topology=NAME\n" +
+			"  GET  /v1/show?topology=NAME[&name=SWITCH...]\n" +
+			"  GET  /v1/distance?topology=NAME&from=NAME&to=NAME\n\n" +
+			"A partition parameter can replace the topology parameter when a topology.yaml file\n" +
+			"and the slurm.conf next to it are served. The topology parameter can be left out\n" +
+			"when a single topology is served, or for the cluster default of a topology.yaml file.",
+		RunE: runServe,
+	}
+)
+
+func init() {
+	serveCmd.Flags().StringArrayVarP(&serveTopologies, "topology", "p", []string{}, "Topology configuration file to serve, as [NAME=]PATH (default name: file name without extension); the topologies of a topology.yaml file keep their names")
+	serveCmd.Flags().StringVar(&listenAddress, "listen", ":8080", "Address to listen on")
+	serveCmd.Flags().StringVar(&plugin, "plugin", "", "Topology plugin, tree or block (default: block if the configuration has BlockName lines)")
+	serveCmd.Flags().BoolVar(&dragonfly, "dragonfly", false, "Optimize the allocation for a dragonfly network (TopologyParam=Dragonfly)")
+	serveCmd.Flags().StringVarP(&weightsFile, "weights", "w", "", "Read node scheduling weights and order from the NodeName lines of a slurm.conf file")
+	serveCmd.Flags().BoolVar(&nodeRank, "switch-as-node-rank", false, "Select and list nodes by leaf switch rank (TopologyParam=SwitchAsNodeRank)")
+	serveCmd.MarkFlagRequired("topology")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// loadTopologies loads each [NAME=]PATH topology of the --topology flags.
+// The topologies of a topology.yaml file keep their names, flat ones are
+// served as nil topologies that queries fail on, and the server options make
+// its cluster default topology the default one and select the topology of
+// the partitions of the slurm.conf file next to it, if any.
+func loadTopologies() (map[string]*tree.Topology, []server.Option, error) {
+	opts, err := loadOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	topologies := map[string]*tree.Topology{}
+	serverOpts := []server.Option{}
+	add := func(name, path string, topo *tree.Topology) error {
+		if _, ok := topologies[name]; ok {
+			return fmt.Errorf("topology %q is given more than once", name)
+		}
+		if topo == nil {
+			log.Infof("Loaded flat topology %s from %s", name, path)
+		} else {
+			log.Infof("Loaded topology %s from %s", name, path)
+		}
+		topologies[name] = topo
+		return nil
+	}
+	for _, arg := range serveTopologies {
+		name, path, found := strings.Cut(arg, "=")
+		if !found {
+			path = arg
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+
+		if !isYAML(path) {
+			topo, err := tree.Load(path, opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := add(name, path, topo); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if found {
+			return nil, nil, fmt.Errorf("%s: the topologies of a topology.yaml file keep their names", arg)
+		}
+		if len(serverOpts) > 0 {
+			return nil, nil, errors.New("only one topology.yaml file can be served")
+		}
+		named, err := tree.LoadYAML(path, opts...)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, nt := range named {
+			if err := add(nt.Name, path, nt.Topology); err != nil {
+				return nil, nil, err
+			}
+		}
+		if def := named.Default(); def.Flat {
+			log.Warnf("The cluster default topology %s is flat, queries without a topology will fail", def.Name)
+		}
+		serverOpts = append(serverOpts, server.WithDefault(named.Default().Name))
+
+		slurmConf := filepath.Join(filepath.Dir(path), "slurm.conf")
+		if _, err := os.Stat(slurmConf); err != nil {
+			continue
+		}
+		partitions, err := tree.LoadPartitionTopologies(slurmConf)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Infof("Loaded the topology of %d partitions from %s", len(partitions), slurmConf)
+		serverOpts = append(serverOpts, server.WithPartitions(partitions))
+	}
+	return topologies, serverOpts, nil
+}
+
+func runServe(cmd *cobra.Command, args []string) error {
+	cmd.SilenceUsage = true
+	topologies, serverOpts, err := loadTopologies()
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return err
+	}
+	log.Info("Listening on ", l.Addr())
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return server.New(topologies, serverOpts...).Serve(ctx, l)
+}
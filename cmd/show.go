@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var showCmd = &cobra.Command{
+	Use:   "show [name...]",
+	Short: "Print the switches or blocks of a topology, as scontrol show topology does",
+	/* Configuration problems are not usage errors */
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		topo, err := loadTopology(pluginOptions()...)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if topo.Plugin() == tree.PluginBlock {
+			for i, block := range topo.Blocks() {
+				if len(args) > 0 && !slices.Contains(args, block.Name) {
+					continue
+				}
+				fmt.Fprintf(out, "BlockName=%s BlockIndex=%d Nodes=%s BlockSize=%d\n",
+					block.Name, i, hostlist.Compress(block.Nodes), len(block.Nodes))
+			}
+			return nil
+		}
+
+		for _, sw := range topo.Switches() {
+			if len(args) > 0 && !slices.Contains(args, sw.Name) {
+				continue
+			}
+			fmt.Fprintf(out, "SwitchName=%s Level=%d LinkSpeed=%d", sw.Name, sw.Level, sw.LinkSpeed)
+			if sw.Parent != "" {
+				fmt.Fprintf(out, " Parent=%s", sw.Parent)
+			}
+			if len(sw.Switches) > 0 {
+				fmt.Fprintf(out, " Switches=%s", hostlist.Compress(sw.Switches))
+			}
+			fmt.Fprintf(out, " Nodes=%s\n", hostlist.Compress(sw.Nodes))
+		}
+		return nil
+	},
+}
+
+func init() {
+	addTopologyFlags(showCmd)
+	rootCmd.AddCommand(showCmd)
+}
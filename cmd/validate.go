@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+var (
+	strict      bool
+	validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a topology configuration file",
+		/* Configuration problems are not usage errors */
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := pluginOptions()
+			if strict {
+				opts = append(opts, tree.WithStrict())
+			}
+			topo, err := loadTopology(opts...)
+			if err != nil {
+				return err
+			}
+
+			for _, diag := range topo.Diagnostics() {
+				fmt.Fprintf(cmd.OutOrStdout(), "warning: %s\n", diag)
+			}
+			if topo.Plugin() == tree.PluginBlock {
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %d blocks, %d nodes\n",
+					topology, len(topo.Blocks()), len(topo.Nodes()))
+				return nil
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %d switches, %d nodes\n",
+				topology, len(topo.Switches()), len(topo.Nodes()))
+			return nil
+		},
+	}
+)
+
+func init() {
+	addTopologyFlags(validateCmd)
+	validateCmd.Flags().BoolVar(&strict, "strict", false, "Fail on any configuration problem instead of skipping it")
+	rootCmd.AddCommand(validateCmd)
+}
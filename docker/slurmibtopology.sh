@@ -15,8 +15,9 @@ prefix=/usr/bin
 IBNETDISCOVER=$sprefix/ibnetdiscover
 IBSTAT=$sprefix/ibstat
 
-# Slurm command for printing sorted hostlists
-export MY_SCONTROL=$prefix/scontrol
+# Command for printing sorted hostlists, as "scontrol show hostlistsorted"
+TOPOLOGY=/usr/local/bin/topology
+export MY_HOSTLIST="$TOPOLOGY hostlist"
 
 # GNU Awk (gawk version 4 is better, but gawk version 3 should work)
 MY_AWK=$prefix/gawk
@@ -63,10 +64,10 @@ then
 	exit -1
 fi
 
-if test ! -x $MY_SCONTROL
+if test ! -x $TOPOLOGY
 then
-	echo "Notice: Command $MY_SCONTROL not found (for sorting hostlists)"
-	export MY_SCONTROL=""
+	echo "Notice: Command $TOPOLOGY not found (for sorting hostlists)"
+	export MY_HOSTLIST=""
 fi
 
 echo Verify the Infiniband interface:
@@ -92,17 +93,17 @@ EOF
 $IBNETDISCOVER -S -p | $MY_AWK '
 BEGIN {
 	# Read the required environment variables:
-        scontrol=ENVIRON["MY_SCONTROL"]
+        hostlistcmd=ENVIRON["MY_HOSTLIST"]
 }
 
 # Define a hostname collapse function:
 function collapse_list(list)
 {
-	if (scontrol == "") {
-		return list	# No scontrol command: collapse cannot be done
+	if (hostlistcmd == "") {
+		return list	# No hostlist command: collapse cannot be done
 	} else {
-		# Collapse the list: Slurm command for sorting hostlists nicely
-		cmd = scontrol " show hostlistsorted " list
+		# Collapse the list: command for sorting hostlists nicely
+		cmd = hostlistcmd " " list
 		cmd | getline sortedlist
 		close (cmd)
 		return sortedlist
@@ -0,0 +1,232 @@
+// Package diff compares the switch records of two topologies, to review what
+// recabling or replacing switches changed.
+package diff
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// Fields of the switches that Change reports.
+const (
+	FieldParents   = "parents"
+	FieldLevel     = "level"
+	FieldLinkSpeed = "link_speed"
+)
+
+// Change is a field of a switch, or block, whose value changed.
+type Change struct {
+	Switch string `json:"switch"`
+	Field  string `json:"field"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// NodeMove is a group of nodes that moved from the same leaf switches, or
+// block, to the same leaf switches. Switch names are hostlist expressions.
+type NodeMove struct {
+	Nodes string `json:"nodes"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// PluginChange is a change of the topology plugin.
+type PluginChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// Diff is the semantic difference between two topologies. Switches are the
+// blocks of block topologies, which are leaves without parents.
+type Diff struct {
+	Equal           bool          `json:"equal"`
+	Plugin          *PluginChange `json:"plugin,omitempty"`
+	AddedSwitches   []string      `json:"added_switches"`
+	RemovedSwitches []string      `json:"removed_switches"`
+	// AddedNodes and RemovedNodes are hostlist expressions.
+	AddedNodes   string     `json:"added_nodes"`
+	RemovedNodes string     `json:"removed_nodes"`
+	MovedNodes   []NodeMove `json:"moved_nodes"`
+	Changes      []Change   `json:"changes"`
+}
+
+/* What Compare compares of a switch or block */
+type switch_info_t struct {
+	level      int
+	parents    []string
+	link_speed uint32
+}
+
+/* Switches of topo in configuration order, and the leaves of each node */
+type records_t struct {
+	names    []string
+	switches map[string]*switch_info_t
+	leaves   map[string][]string
+	nodes    []string
+}
+
+func _records(topo *tree.Topology) *records_t {
+	r := &records_t{
+		switches: map[string]*switch_info_t{},
+		leaves:   map[string][]string{},
+		nodes:    topo.Nodes(),
+	}
+	for _, block := range topo.Blocks() {
+		r.names = append(r.names, block.Name)
+		r.switches[block.Name] = &switch_info_t{parents: []string{}}
+		for _, node := range block.Nodes {
+			r.leaves[node] = append(r.leaves[node], block.Name)
+		}
+	}
+
+	switches := topo.Switches()
+	for _, sw := range switches {
+		r.names = append(r.names, sw.Name)
+		r.switches[sw.Name] = &switch_info_t{level: sw.Level, parents: []string{}, link_speed: sw.LinkSpeed}
+		if sw.Level == 0 {
+			for _, node := range sw.Nodes {
+				r.leaves[node] = append(r.leaves[node], sw.Name)
+			}
+		}
+	}
+	/* A switch can be the child of several switches, not only of Parent */
+	for _, sw := range switches {
+		for _, child := range sw.Switches {
+			r.switches[child].parents = append(r.switches[child].parents, sw.Name)
+		}
+	}
+
+	/* Reordering the lines of a configuration changes nothing */
+	for _, info := range r.switches {
+		slices.SortFunc(info.parents, hostlist.Compare)
+	}
+	for _, leaves := range r.leaves {
+		slices.SortFunc(leaves, hostlist.Compare)
+	}
+	return r
+}
+
+// Compare returns the difference between the before and after topologies.
+func Compare(before, after *tree.Topology) *Diff {
+	d := &Diff{
+		AddedSwitches:   []string{},
+		RemovedSwitches: []string{},
+		MovedNodes:      []NodeMove{},
+		Changes:         []Change{},
+	}
+	if before.Plugin() != after.Plugin() {
+		d.Plugin = &PluginChange{Old: before.Plugin(), New: after.Plugin()}
+	}
+	o, n := _records(before), _records(after)
+
+	for _, name := range o.names {
+		if _, ok := n.switches[name]; !ok {
+			d.RemovedSwitches = append(d.RemovedSwitches, name)
+		}
+	}
+	for _, name := range n.names {
+		old_sw, ok := o.switches[name]
+		if !ok {
+			d.AddedSwitches = append(d.AddedSwitches, name)
+			continue
+		}
+		new_sw := n.switches[name]
+		if old_parents, new_parents := hostlist.Compress(old_sw.parents), hostlist.Compress(new_sw.parents); old_parents != new_parents {
+			d.Changes = append(d.Changes, Change{Switch: name, Field: FieldParents, Old: old_parents, New: new_parents})
+		}
+		if old_sw.level != new_sw.level {
+			d.Changes = append(d.Changes, Change{Switch: name, Field: FieldLevel,
+				Old: strconv.Itoa(old_sw.level), New: strconv.Itoa(new_sw.level)})
+		}
+		if old_sw.link_speed != new_sw.link_speed {
+			d.Changes = append(d.Changes, Change{Switch: name, Field: FieldLinkSpeed,
+				Old: strconv.FormatUint(uint64(old_sw.link_speed), 10),
+				New: strconv.FormatUint(uint64(new_sw.link_speed), 10)})
+		}
+	}
+
+	added, removed := []string{}, []string{}
+	for _, node := range o.nodes {
+		if _, ok := n.leaves[node]; !ok {
+			removed = append(removed, node)
+		}
+	}
+	/* Nodes moving between the same leaves are grouped, in node order */
+	moves := map[[2]string][]string{}
+	keys := [][2]string{}
+	for _, node := range n.nodes {
+		if _, ok := o.leaves[node]; !ok {
+			added = append(added, node)
+			continue
+		}
+		from, to := hostlist.Compress(o.leaves[node]), hostlist.Compress(n.leaves[node])
+		if from == to {
+			continue
+		}
+		key := [2]string{from, to}
+		if _, ok := moves[key]; !ok {
+			keys = append(keys, key)
+		}
+		moves[key] = append(moves[key], node)
+	}
+	for _, key := range keys {
+		d.MovedNodes = append(d.MovedNodes, NodeMove{Nodes: hostlist.Compress(moves[key]), From: key[0], To: key[1]})
+	}
+	d.AddedNodes = hostlist.Compress(added)
+	d.RemovedNodes = hostlist.Compress(removed)
+
+	d.Equal = d.Plugin == nil && len(d.AddedSwitches) == 0 && len(d.RemovedSwitches) == 0 &&
+		len(added) == 0 && len(removed) == 0 && len(d.MovedNodes) == 0 && len(d.Changes) == 0
+	return d
+}
+
+/* Return v, or "none" for an empty list of parents */
+func _or_none(v string) string {
+	if v == "" {
+		return "none"
+	}
+	return v
+}
+
+// WriteText writes d one difference per line: "+" for added switches and
+// nodes, "-" for removed ones, ">" for moved nodes and "~" for changes.
+func WriteText(w io.Writer, d *Diff) error {
+	lines := []string{}
+	if d.Plugin != nil {
+		lines = append(lines, fmt.Sprintf("~ plugin: %s -> %s", d.Plugin.Old, d.Plugin.New))
+	}
+	for _, name := range d.RemovedSwitches {
+		lines = append(lines, "- switch "+name)
+	}
+	for _, name := range d.AddedSwitches {
+		lines = append(lines, "+ switch "+name)
+	}
+	for _, c := range d.Changes {
+		old_value, new_value := c.Old, c.New
+		if c.Field == FieldParents {
+			old_value, new_value = _or_none(old_value), _or_none(new_value)
+		}
+		lines = append(lines, fmt.Sprintf("~ switch %s: %s %s -> %s", c.Switch, c.Field, old_value, new_value))
+	}
+	if d.RemovedNodes != "" {
+		lines = append(lines, "- nodes "+d.RemovedNodes)
+	}
+	if d.AddedNodes != "" {
+		lines = append(lines, "+ nodes "+d.AddedNodes)
+	}
+	for _, m := range d.MovedNodes {
+		lines = append(lines, fmt.Sprintf("> nodes %s: %s -> %s", m.Nodes, m.From, m.To))
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
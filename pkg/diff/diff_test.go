@@ -0,0 +1,120 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+func _load(tb testing.TB, conf string) *tree.Topology {
+	topo, err := tree.LoadReader(strings.NewReader(conf), "inline.conf")
+	require.NoError(tb, err)
+	return topo
+}
+
+func TestCompare(t *testing.T) {
+	before, err := tree.Load("../../test/topology1.conf")
+	require.NoError(t, err)
+
+	/* Reordered and recompressed, the configuration is the same */
+	d := Compare(before, _load(t, `SwitchName=s6 Switches=s4,s5
+SwitchName=s5 Switches=s[2-3]
+SwitchName=s4 Switches=s[0-1]
+SwitchName=s3 Nodes=tux7,tux6
+SwitchName=s2 Nodes=tux[4-5]
+SwitchName=s1 Nodes=tu-x[2-3]
+SwitchName=s0 Nodes=tu-x[0-1]
+`))
+	require.True(t, d.Equal)
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, d))
+	require.Empty(t, buf.String())
+
+	/* s3 is replaced by s7 under s4, tux[8-9] are cabled to it */
+	d = Compare(before, _load(t, `SwitchName=s0 Nodes=tu-x[0-1]
+SwitchName=s1 Nodes=tu-x[2-3],tux4
+SwitchName=s2 Nodes=tux5     LinkSpeed=900
+SwitchName=s7 Nodes=tux[6-9]
+SwitchName=s4 Switches=s[0-1],s7
+SwitchName=s5 Switches=s2
+SwitchName=s6 Switches=s[4-5]
+`))
+	require.False(t, d.Equal)
+	require.Equal(t, []string{"s3"}, d.RemovedSwitches)
+	require.Equal(t, []string{"s7"}, d.AddedSwitches)
+	require.Equal(t, "tux[8-9]", d.AddedNodes)
+	require.Empty(t, d.RemovedNodes)
+	require.Equal(t, []NodeMove{
+		{Nodes: "tux4", From: "s2", To: "s1"},
+		{Nodes: "tux[6-7]", From: "s3", To: "s7"},
+	}, d.MovedNodes)
+	require.Equal(t, []Change{{Switch: "s2", Field: FieldLinkSpeed, Old: "0", New: "900"}}, d.Changes)
+
+	buf.Reset()
+	require.NoError(t, WriteText(&buf, d))
+	require.Equal(t, `- switch s3
++ switch s7
+~ switch s2: link_speed 0 -> 900
++ nodes tux[8-9]
+> nodes tux4: s2 -> s1
+> nodes tux[6-7]: s3 -> s7
+`, buf.String())
+
+	/* A switch inserted above s5 makes s6 a level higher */
+	d = Compare(before, _load(t, `SwitchName=s0 Nodes=tu-x[0-1]
+SwitchName=s1 Nodes=tu-x[2-3]
+SwitchName=s2 Nodes=tux[4-5]
+SwitchName=s3 Nodes=tux[6-7]
+SwitchName=s4 Switches=s[0-1]
+SwitchName=s5 Switches=s[2-3]
+SwitchName=s8 Switches=s5
+SwitchName=s6 Switches=s4,s8
+`))
+	require.Equal(t, []string{"s8"}, d.AddedSwitches)
+	require.Empty(t, d.MovedNodes)
+	require.Equal(t, []Change{
+		{Switch: "s5", Field: FieldParents, Old: "s6", New: "s8"},
+		{Switch: "s6", Field: FieldLevel, Old: "2", New: "3"},
+	}, d.Changes)
+}
+
+func TestCompare_parents(t *testing.T) {
+	before, err := tree.Load("../../test/topology2.conf")
+	require.NoError(t, err)
+
+	/* s3 hangs off s4 and s5 only, and a new core switch adds a level */
+	d := Compare(before, _load(t, `SwitchName=s0 Nodes=tux[0-3]   LinkSpeed=900
+SwitchName=s1 Nodes=tux[4-7]   LinkSpeed=900
+SwitchName=s2 Nodes=tux[8-11]  LinkSpeed=900
+SwitchName=s3 Nodes=tux[12-15] LinkSpeed=1800
+SwitchName=s4 Switches=s[0-3]  LinkSpeed=1800
+SwitchName=s5 Switches=s[0-3]  LinkSpeed=1800
+SwitchName=s6 Switches=s[0-2]  LinkSpeed=1800
+SwitchName=s7 Switches=s[0-2]  LinkSpeed=1800
+SwitchName=core Switches=s[4-7]
+`))
+	require.Equal(t, []string{"core"}, d.AddedSwitches)
+	require.Equal(t, []Change{
+		{Switch: "s3", Field: FieldParents, Old: "s[4-7]", New: "s[4-5]"},
+		{Switch: "s4", Field: FieldParents, Old: "", New: "core"},
+		{Switch: "s5", Field: FieldParents, Old: "", New: "core"},
+		{Switch: "s6", Field: FieldParents, Old: "", New: "core"},
+		{Switch: "s7", Field: FieldParents, Old: "", New: "core"},
+	}, d.Changes)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteText(&buf, d))
+	require.Contains(t, buf.String(), "~ switch s4: parents none -> core\n")
+
+	/* A tree and a block topology differ by plugin */
+	block, err := tree.Load("../../test/block1.conf")
+	require.NoError(t, err)
+	d = Compare(before, block)
+	require.Equal(t, &PluginChange{Old: tree.PluginTree, New: tree.PluginBlock}, d.Plugin)
+	require.Len(t, d.RemovedSwitches, 8)
+	require.Equal(t, "gb200-[001-072]", d.AddedNodes)
+}
@@ -0,0 +1,216 @@
+// Package ib discovers the topology of an InfiniBand fabric from the output
+// of ibnetdiscover -S -p, as docker/slurmibtopology.sh does.
+package ib
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// SwitchPrefix is the prefix of the names given to switches, numbered from 1
+// in discovery order.
+const SwitchPrefix = "ibsw"
+
+/* Neighbor description of the links to SHARP aggregation nodes */
+const aggregationNode = "Mellanox Technologies Aggregation Node"
+
+// ErrSyntax is returned when a switch port line can not be parsed.
+var ErrSyntax = errors.New("invalid ibnetdiscover port line")
+
+// Switch is a switch of the fabric with active links.
+type Switch struct {
+	// Name is the name given to the switch in the topology.
+	Name string
+	// GUID is the node GUID identifying the switch.
+	GUID string
+	// Description is the node description of the switch.
+	Description string
+	// Hosts are the hosts linked to the switch, in discovery order.
+	Hosts []string
+	// Neighbors are the GUIDs of the switches linked to the switch, in
+	// discovery order.
+	Neighbors []string
+	// Links is the number of active links to each neighbor switch GUID.
+	Links map[string]int
+	// Level is the distance in links to the closest switch with hosts, -1 if
+	// the switch is not connected to any host.
+	Level int
+}
+
+// Fabric is the switches of an InfiniBand fabric, in discovery order.
+type Fabric struct {
+	Switches []*Switch
+	by_guid  map[string]*Switch
+}
+
+// Parse reads the output of ibnetdiscover -S -p. Only switch port lines are
+// used: inactive links and links to aggregation nodes are skipped, and a host
+// is the first word of the node description of a channel adapter.
+func Parse(r io.Reader) (*Fabric, error) {
+	f := &Fabric{by_guid: map[string]*Switch{}}
+
+	s := bufio.NewScanner(r)
+	line := 0
+	for s.Scan() {
+		line++
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || fields[0] != "SW" {
+			continue
+		}
+		if err := f._parse_port(s.Text(), fields); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	f._set_levels()
+	return f, nil
+}
+
+/* Parse the line of a switch port */
+func (f *Fabric) _parse_port(text string, fields []string) error {
+	if len(fields) < 5 {
+		return fmt.Errorf("%w: %q", ErrSyntax, text)
+	}
+	/* The switch then the neighbor node descriptions are single quoted */
+	comment := strings.Split(text, "'")
+	sw_desc, node_desc := "", ""
+	if len(comment) > 1 {
+		sw_desc = comment[1]
+	}
+	if len(comment) > 3 {
+		node_desc = comment[3]
+	}
+	if node_desc == "" || node_desc == aggregationNode {
+		return nil
+	}
+
+	guid := fields[3]
+	sw, ok := f.by_guid[guid]
+	if !ok {
+		sw = &Switch{
+			Name:        fmt.Sprintf("%s%d", SwitchPrefix, len(f.Switches)+1),
+			GUID:        guid,
+			Description: sw_desc,
+			Hosts:       []string{},
+			Neighbors:   []string{},
+			Links:       map[string]int{},
+		}
+		f.Switches = append(f.Switches, sw)
+		f.by_guid[guid] = sw
+	}
+
+	if len(fields) < 11 || fields[6] != "-" {
+		return fmt.Errorf("%w: %q", ErrSyntax, text)
+	}
+	/* The width or speed of an inactive link is unknown */
+	if strings.HasPrefix(fields[4], "??") || strings.HasPrefix(fields[5], "??") {
+		return nil
+	}
+	switch neighbor_type, neighbor_guid := fields[7], fields[10]; neighbor_type {
+	case "CA":
+		/* Hosts with several links are listed once */
+		host := strings.Fields(node_desc)[0]
+		if !slices.Contains(sw.Hosts, host) {
+			sw.Hosts = append(sw.Hosts, host)
+		}
+	case "SW":
+		if sw.Links[neighbor_guid] == 0 {
+			sw.Neighbors = append(sw.Neighbors, neighbor_guid)
+		}
+		sw.Links[neighbor_guid]++
+	}
+	return nil
+}
+
+/*
+ * Number levels up from the switches with hosts, breadth first, so that a
+ * switch only lists the neighbors one level down and the switches form a
+ * tree Slurm can load.
+ */
+func (f *Fabric) _set_levels() {
+	queue := []*Switch{}
+	for _, sw := range f.Switches {
+		sw.Level = -1
+		if len(sw.Hosts) > 0 {
+			sw.Level = 0
+			queue = append(queue, sw)
+		}
+	}
+	for ; len(queue) > 0; queue = queue[1:] {
+		for _, guid := range queue[0].Neighbors {
+			if neighbor, ok := f.by_guid[guid]; ok && neighbor.Level == -1 {
+				neighbor.Level = queue[0].Level + 1
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+}
+
+// Children returns the names of the switches one level below sw.
+func (f *Fabric) Children(sw *Switch) []string {
+	children := []string{}
+	for _, guid := range sw.Neighbors {
+		if neighbor, ok := f.by_guid[guid]; ok && neighbor.Level == sw.Level-1 {
+			children = append(children, neighbor.Name)
+		}
+	}
+	return children
+}
+
+// WriteTopologyConf writes the fabric as a topology.conf file. Switches with
+// hosts list them as Nodes, the others list their neighbors one level down as
+// Switches. Switches not connected to any host are left out. With comments,
+// each switch is described as slurmibtopology.sh does.
+func (f *Fabric) WriteTopologyConf(w io.Writer, comments bool) error {
+	bw := bufio.NewWriter(w)
+	for i, sw := range f.Switches {
+		if comments {
+			fmt.Fprintf(bw, "#\n# IB switch no. %d: %s GUID: %s Description: %s\n#\n",
+				i+1, sw.Name, sw.GUID, sw.Description)
+			total := 0
+			for _, guid := range sw.Neighbors {
+				fmt.Fprintf(bw, "# Switch neighbor %s with %d links\n", guid, sw.Links[guid])
+				total += sw.Links[guid]
+			}
+			fmt.Fprintf(bw, "# Total number of links in this switch = %d\n", total)
+		}
+
+		switch {
+		case len(sw.Hosts) > 0:
+			fmt.Fprintf(bw, "SwitchName=%s Nodes=%s\n", sw.Name, hostlist.Compress(sw.Hosts))
+		case sw.Level > 0:
+			if comments {
+				fmt.Fprintf(bw, "# NOTICE: This switch %s has no attached nodes (empty hostlist)\n", sw.Name)
+			}
+			fmt.Fprintf(bw, "SwitchName=%s Switches=%s\n", sw.Name, hostlist.Compress(f.Children(sw)))
+		default:
+			log.Warnf("Switch %s (%s) is not connected to any host, skipping it", sw.Name, sw.GUID)
+			if comments {
+				fmt.Fprintf(bw, "# NOTICE: This switch %s is not connected to any host\n", sw.Name)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// Topology returns the fabric as a topology/tree topology.
+func (f *Fabric) Topology(opts ...tree.LoadOption) (*tree.Topology, error) {
+	var buf bytes.Buffer
+	if err := f.WriteTopologyConf(&buf, false); err != nil {
+		return nil, err
+	}
+	return tree.LoadReader(&buf, "ibnetdiscover", opts...)
+}
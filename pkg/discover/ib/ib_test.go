@@ -0,0 +1,68 @@
+package ib
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func _parse_fixture(tb testing.TB, name string) *Fabric {
+	file, err := os.Open(filepath.Join("testdata", name))
+	require.NoError(tb, err)
+	defer file.Close()
+	f, err := Parse(file)
+	require.NoError(tb, err)
+	return f
+}
+
+func TestParse(t *testing.T) {
+	f := _parse_fixture(t, "fattree.txt")
+	require.Len(t, f.Switches, 3)
+
+	core, leaf01, leaf02 := f.Switches[0], f.Switches[1], f.Switches[2]
+	require.Equal(t, "ibsw1", core.Name)
+	require.Equal(t, "0xe41d2d0300a1b2c0", core.GUID)
+	require.Equal(t, "MF0;core01:MSB7800/U1", core.Description)
+	require.Empty(t, core.Hosts)
+	require.Equal(t, []string{"0xe41d2d0300a1b300", "0xe41d2d0300a1b340"}, core.Neighbors)
+	require.Equal(t, map[string]int{"0xe41d2d0300a1b300": 2, "0xe41d2d0300a1b340": 2}, core.Links)
+	require.Equal(t, 1, core.Level)
+
+	/* Inactive links are skipped, hosts with several links listed once */
+	require.Equal(t, []string{"node001", "node003", "node002"}, leaf01.Hosts)
+	require.Equal(t, 0, leaf01.Level)
+	require.Equal(t, []string{"node004", "node005"}, leaf02.Hosts)
+	require.Equal(t, []string{"ibsw2", "ibsw3"}, f.Children(core))
+
+	_, err := Parse(strings.NewReader("SW 1 1 0xe41d2d0300a1b2c0 4x EDR ( 'core01' - 'leaf01' )\n"))
+	require.ErrorIs(t, err, ErrSyntax)
+	require.Contains(t, err.Error(), "line 1")
+}
+
+func TestFabric_WriteTopologyConf(t *testing.T) {
+	f := _parse_fixture(t, "fattree.txt")
+
+	var buf bytes.Buffer
+	require.NoError(t, f.WriteTopologyConf(&buf, false))
+	require.Equal(t, `SwitchName=ibsw1 Switches=ibsw[2-3]
+SwitchName=ibsw2 Nodes=node[001-003]
+SwitchName=ibsw3 Nodes=node[004-005]
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, f.WriteTopologyConf(&buf, true))
+	require.Contains(t, buf.String(), "# IB switch no. 1: ibsw1 GUID: 0xe41d2d0300a1b2c0 Description: MF0;core01:MSB7800/U1\n")
+	require.Contains(t, buf.String(), "# Switch neighbor 0xe41d2d0300a1b300 with 2 links\n")
+	require.Contains(t, buf.String(), "# Total number of links in this switch = 4\n")
+
+	topo, err := f.Topology()
+	require.NoError(t, err)
+	require.Equal(t, []string{"node001", "node002", "node003", "node004", "node005"}, topo.Nodes())
+	dist, err := topo.Distance("node001", "ibsw3")
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), dist)
+}
@@ -0,0 +1,278 @@
+// Package export draws the switch hierarchy or the blocks of a topology as a
+// Graphviz DOT or Mermaid graph, optionally highlighting a node selection.
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// Formats are the names of the supported graph formats.
+var Formats = []string{"dot", "mermaid"}
+
+// vertex is a switch, a block or a group of nodes of a leaf switch or block.
+type vertex struct {
+	id       string
+	label    string
+	selected bool
+}
+
+// edge links a switch to a child switch, or a leaf switch or a block to a
+// group of nodes.
+type edge struct {
+	from, to string
+	label    string
+	selected bool
+}
+
+// rank is the switches of a level, or the blocks of a block topology.
+type rank struct {
+	name     string
+	vertices []vertex
+}
+
+// graph is the drawing of a topology, independent of the format.
+type graph struct {
+	ranks  []rank /* from the top level down */
+	groups []vertex
+	edges  []edge
+}
+
+/* Return the groups of nodes of a leaf switch or block, selected ones first */
+func _node_groups(nodes []string, selected map[string]bool) [][]string {
+	in, out := []string{}, []string{}
+	for _, node := range nodes {
+		if selected[node] {
+			in = append(in, node)
+		} else {
+			out = append(out, node)
+		}
+	}
+	groups := [][]string{}
+	for _, group := range [][]string{in, out} {
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+func _link_speed(speed uint32) string {
+	if speed == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(speed), 10)
+}
+
+/* Add the groups of nodes of the leaf switch or block of vertex v */
+func (g *graph) _add_groups(v vertex, nodes []string, label string, selected map[string]bool) {
+	for _, group := range _node_groups(nodes, selected) {
+		gv := vertex{
+			id:       fmt.Sprintf("g%d", len(g.groups)),
+			label:    hostlist.Compress(group),
+			selected: selected[group[0]],
+		}
+		g.groups = append(g.groups, gv)
+		g.edges = append(g.edges, edge{from: v.id, to: gv.id, label: label, selected: gv.selected})
+	}
+}
+
+/*
+ * Build the graph of topo. The switches highlighted for sel are those above
+ * selected nodes, under the top switch of sel if it has one.
+ */
+func _build(topo *tree.Topology, sel *tree.Selection) *graph {
+	g := &graph{}
+	selected := map[string]bool{}
+	if sel != nil {
+		for _, node := range sel.Nodes {
+			selected[node] = true
+		}
+	}
+
+	if topo.Plugin() == tree.PluginBlock {
+		r := rank{name: "Blocks"}
+		for i, block := range topo.Blocks() {
+			v := vertex{
+				id:       fmt.Sprintf("b%d", i),
+				label:    block.Name,
+				selected: slices.ContainsFunc(block.Nodes, func(node string) bool { return selected[node] }),
+			}
+			r.vertices = append(r.vertices, v)
+			g._add_groups(v, block.Nodes, "", selected)
+		}
+		g.ranks = append(g.ranks, r)
+		return g
+	}
+
+	switches := topo.Switches()
+	ids := map[string]string{}
+	by_name := map[string]tree.Switch{}
+	top_level := 0
+	for i, sw := range switches {
+		ids[sw.Name] = fmt.Sprintf("sw%d", i)
+		by_name[sw.Name] = sw
+		top_level = max(top_level, sw.Level)
+	}
+
+	/* Switches under the top switch of the selection, all without one */
+	under_top := map[string]bool{}
+	var mark func(name string)
+	mark = func(name string) {
+		under_top[name] = true
+		for _, child := range by_name[name].Switches {
+			mark(child)
+		}
+	}
+	if sel != nil && sel.TopSwitch != "" {
+		mark(sel.TopSwitch)
+	} else {
+		for _, sw := range switches {
+			under_top[sw.Name] = true
+		}
+	}
+	highlighted := map[string]bool{}
+	for _, sw := range switches {
+		highlighted[sw.Name] = under_top[sw.Name] &&
+			slices.ContainsFunc(sw.Nodes, func(node string) bool { return selected[node] })
+	}
+
+	g.ranks = make([]rank, top_level+1)
+	for level := range g.ranks {
+		name := fmt.Sprintf("Level %d", top_level-level)
+		if level == top_level {
+			name = "Leaf switches"
+		}
+		g.ranks[level].name = name
+	}
+	for _, sw := range switches {
+		v := vertex{id: ids[sw.Name], label: sw.Name, selected: highlighted[sw.Name]}
+		r := &g.ranks[top_level-sw.Level]
+		r.vertices = append(r.vertices, v)
+	}
+
+	for _, sw := range switches {
+		for _, child := range sw.Switches {
+			g.edges = append(g.edges, edge{
+				from:     ids[sw.Name],
+				to:       ids[child],
+				label:    _link_speed(by_name[child].LinkSpeed),
+				selected: highlighted[sw.Name] && highlighted[child],
+			})
+		}
+		if sw.Level == 0 {
+			v := vertex{id: ids[sw.Name], selected: highlighted[sw.Name]}
+			g._add_groups(v, sw.Nodes, _link_speed(sw.LinkSpeed), selected)
+		}
+	}
+	return g
+}
+
+// WriteDOT writes topo as a Graphviz DOT digraph: switches ranked by level,
+// from the top level down, edges to child switches labelled with the
+// LinkSpeed of the child, and the nodes of each leaf switch as hostlists.
+// With sel, the selected nodes and the switches above them are highlighted.
+func WriteDOT(w io.Writer, topo *tree.Topology, sel *tree.Selection) error {
+	g := _build(topo, sel)
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph topology {")
+	fmt.Fprintln(bw, "\trankdir=TB;")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	attrs := func(v vertex) string {
+		if v.selected {
+			return fmt.Sprintf("label=%q, color=red, penwidth=2", v.label)
+		}
+		return fmt.Sprintf("label=%q", v.label)
+	}
+	for i, r := range g.ranks {
+		fmt.Fprintf(bw, "\tsubgraph rank%d {\n\t\trank=same;\n\t\t/* %s */\n", i, r.name)
+		for _, v := range r.vertices {
+			fmt.Fprintf(bw, "\t\t%s [%s];\n", v.id, attrs(v))
+		}
+		fmt.Fprintln(bw, "\t}")
+	}
+	fmt.Fprintln(bw, "\tsubgraph nodes {\n\t\trank=same;\n\t\tnode [shape=note];")
+	for _, v := range g.groups {
+		if v.selected {
+			fmt.Fprintf(bw, "\t\t%s [%s, style=filled, fillcolor=\"#ffcccc\"];\n", v.id, attrs(v))
+		} else {
+			fmt.Fprintf(bw, "\t\t%s [%s];\n", v.id, attrs(v))
+		}
+	}
+	fmt.Fprintln(bw, "\t}")
+	for _, e := range g.edges {
+		a := []string{}
+		if e.label != "" {
+			a = append(a, fmt.Sprintf("label=%q", e.label))
+		}
+		if e.selected {
+			a = append(a, "color=red", "penwidth=2")
+		}
+		if len(a) > 0 {
+			fmt.Fprintf(bw, "\t%s -> %s [%s];\n", e.from, e.to, strings.Join(a, ", "))
+		} else {
+			fmt.Fprintf(bw, "\t%s -> %s;\n", e.from, e.to)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+/* Mermaid labels are quoted, quotes are written as entity codes */
+func _mermaid_label(label string) string {
+	return `"` + strings.ReplaceAll(label, `"`, "#quot;") + `"`
+}
+
+// WriteMermaid writes topo as a Mermaid flowchart, drawn as WriteDOT draws
+// it. Each level is a subgraph.
+func WriteMermaid(w io.Writer, topo *tree.Topology, sel *tree.Selection) error {
+	g := _build(topo, sel)
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "flowchart TB")
+	selected := []string{}
+	for i, r := range g.ranks {
+		fmt.Fprintf(bw, "\tsubgraph rank%d [%s]\n", i, _mermaid_label(r.name))
+		for _, v := range r.vertices {
+			fmt.Fprintf(bw, "\t\t%s[%s]\n", v.id, _mermaid_label(v.label))
+			if v.selected {
+				selected = append(selected, v.id)
+			}
+		}
+		fmt.Fprintln(bw, "\tend")
+	}
+	for _, v := range g.groups {
+		fmt.Fprintf(bw, "\t%s[/%s/]\n", v.id, _mermaid_label(v.label))
+		if v.selected {
+			selected = append(selected, v.id)
+		}
+	}
+
+	selected_edges := []string{}
+	for i, e := range g.edges {
+		if e.label != "" {
+			fmt.Fprintf(bw, "\t%s -->|%s| %s\n", e.from, _mermaid_label(e.label), e.to)
+		} else {
+			fmt.Fprintf(bw, "\t%s --> %s\n", e.from, e.to)
+		}
+		if e.selected {
+			selected_edges = append(selected_edges, strconv.Itoa(i))
+		}
+	}
+	if len(selected) > 0 {
+		fmt.Fprintln(bw, "\tclassDef selected fill:#ffcccc,stroke:#cc0000,stroke-width:2px")
+		fmt.Fprintf(bw, "\tclass %s selected\n", strings.Join(selected, ","))
+	}
+	if len(selected_edges) > 0 {
+		fmt.Fprintf(bw, "\tlinkStyle %s stroke:#cc0000,stroke-width:2px\n", strings.Join(selected_edges, ","))
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,84 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+func _load(tb testing.TB, filename string) *tree.Topology {
+	topo, err := tree.Load("../../test/" + filename)
+	require.NoError(tb, err)
+	return topo
+}
+
+func TestWriteDOT(t *testing.T) {
+	topo := _load(t, "topology2.conf")
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteDOT(&buf, topo, nil))
+	out := buf.String()
+	require.Contains(t, out, "\tsubgraph rank0 {\n\t\trank=same;\n\t\t/* Level 1 */\n\t\tsw4 [label=\"s4\"];\n")
+	require.Contains(t, out, "\t\tg3 [label=\"tux[12-15]\"];\n")
+	/* Switch edges are labelled with the LinkSpeed of the child */
+	require.Contains(t, out, "\tsw7 -> sw3 [label=\"1800\"];\n")
+	require.Contains(t, out, "\tsw0 -> g0 [label=\"900\"];\n")
+	require.NotContains(t, out, "red")
+
+	/* The selection is highlighted under its top switch */
+	topo = _load(t, "topology1.conf")
+	sel, err := topo.Eval([]string{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}, nil, 3)
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, WriteDOT(&buf, topo, sel))
+	out = buf.String()
+	require.Contains(t, out, "\t\tsw6 [label=\"s6\", color=red, penwidth=2];\n")
+	require.Contains(t, out, "\t\tsw4 [label=\"s4\"];\n")
+	require.Contains(t, out, "\t\tg2 [label=\"tux5\", color=red, penwidth=2, style=filled, fillcolor=\"#ffcccc\"];\n")
+	require.Contains(t, out, "\t\tg3 [label=\"tux4\"];\n")
+	require.Contains(t, out, "\tsw6 -> sw5 [color=red, penwidth=2];\n")
+	require.Contains(t, out, "\tsw6 -> sw4;\n")
+}
+
+func TestWriteMermaid(t *testing.T) {
+	topo := _load(t, "block1.conf")
+	available, err := hostlist.Expand("gb200-[001-072]")
+	require.NoError(t, err)
+	sel, err := topo.Eval(available, nil, 20)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteMermaid(&buf, topo, sel))
+	require.Equal(t, `flowchart TB
+	subgraph rank0 ["Blocks"]
+		b0["b1"]
+		b1["b2"]
+		b2["b3"]
+		b3["b4"]
+	end
+	g0[/"gb200-[001-018]"/]
+	g1[/"gb200-[019-020]"/]
+	g2[/"gb200-[021-036]"/]
+	g3[/"gb200-[037-054]"/]
+	g4[/"gb200-[055-072]"/]
+	b0 --> g0
+	b1 --> g1
+	b1 --> g2
+	b2 --> g3
+	b3 --> g4
+	classDef selected fill:#ffcccc,stroke:#cc0000,stroke-width:2px
+	class b0,b1,g0,g1 selected
+	linkStyle 0,1 stroke:#cc0000,stroke-width:2px
+`, buf.String())
+
+	topo = _load(t, "topology2.conf")
+	buf.Reset()
+	require.NoError(t, WriteMermaid(&buf, topo, nil))
+	require.Contains(t, buf.String(), "\tsubgraph rank1 [\"Leaf switches\"]\n")
+	require.Contains(t, buf.String(), "\tsw4 -->|\"900\"| sw0\n")
+	require.NotContains(t, buf.String(), "classDef")
+}
@@ -0,0 +1,323 @@
+// Package extender implements the filter and prioritize verbs of a
+// kube-scheduler extender, so that the pods of a group land on the fewest
+// leaf switches of a topology.
+package extender
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// DefaultNodeCountAnnotation is the default pod annotation holding the number
+// of nodes of the pod group.
+const DefaultNodeCountAnnotation = "topology.slurm/node-count"
+
+// maxRequestSize bounds the size of a request body, which lists all nodes.
+const maxRequestSize = 32 << 20
+
+// Config configures how Kubernetes objects map to the topology.
+type Config struct {
+	// NodeNameLabel is the node label holding the topology node name of a
+	// Kubernetes node. Without it, the topology node name is the Kubernetes
+	// node name, or its short name without domain.
+	NodeNameLabel string
+	// NodeCountAnnotation is the pod annotation holding the number of nodes
+	// of the pod group, DefaultNodeCountAnnotation if empty. A pod without
+	// it is placed alone.
+	NodeCountAnnotation string
+}
+
+// Extender answers kube-scheduler extender requests with the node selection
+// of a topology. It is stateless: the nodes of a group are evaluated among
+// the candidates of each request. It is safe for concurrent use.
+type Extender struct {
+	topo   *tree.Topology
+	config Config
+	nodes  map[string]bool
+	/* nodes of each switch, or block of a block topology */
+	group_nodes map[string]map[string]bool
+	mux         *http.ServeMux
+}
+
+// candidate is a node of a request.
+type candidate struct {
+	name      string /* Kubernetes node name */
+	topo_name string /* topology node name, empty if not in the topology */
+}
+
+// New returns an Extender placing pods on the nodes of topo.
+func New(topo *tree.Topology, config Config) *Extender {
+	if config.NodeCountAnnotation == "" {
+		config.NodeCountAnnotation = DefaultNodeCountAnnotation
+	}
+	e := &Extender{
+		topo:        topo,
+		config:      config,
+		nodes:       map[string]bool{},
+		group_nodes: map[string]map[string]bool{},
+		mux:         http.NewServeMux(),
+	}
+	for _, node := range topo.Nodes() {
+		e.nodes[node] = true
+	}
+	for _, sw := range topo.Switches() {
+		e._add_group(sw.Name, sw.Nodes)
+	}
+	for _, block := range topo.Blocks() {
+		e._add_group(block.Name, block.Nodes)
+	}
+
+	e.mux.HandleFunc("/filter", e.handleFilter)
+	e.mux.HandleFunc("/prioritize", e.handlePrioritize)
+	e.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return e
+}
+
+func (e *Extender) _add_group(name string, nodes []string) {
+	e.group_nodes[name] = map[string]bool{}
+	for _, node := range nodes {
+		e.group_nodes[name][node] = true
+	}
+}
+
+// ServeHTTP routes a request to its verb.
+func (e *Extender) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mux.ServeHTTP(w, r)
+}
+
+// topoName returns the topology node name of a Kubernetes node, empty if the
+// node is not in the topology.
+func (e *Extender) topoName(name string, labels map[string]string) string {
+	if label, ok := labels[e.config.NodeNameLabel]; ok && e.config.NodeNameLabel != "" {
+		name = label
+	}
+	if e.nodes[name] {
+		return name
+	}
+	if short, _, found := strings.Cut(name, "."); found && e.nodes[short] {
+		return short
+	}
+	return ""
+}
+
+// candidates returns the nodes of args, in order.
+func (e *Extender) candidates(args *ExtenderArgs) []candidate {
+	candidates := []candidate{}
+	if args.Nodes != nil {
+		for _, node := range args.Nodes.Items {
+			candidates = append(candidates, candidate{
+				name:      node.Metadata.Name,
+				topo_name: e.topoName(node.Metadata.Name, node.Metadata.Labels),
+			})
+		}
+	} else if args.NodeNames != nil {
+		for _, name := range *args.NodeNames {
+			candidates = append(candidates, candidate{name: name, topo_name: e.topoName(name, nil)})
+		}
+	}
+	return candidates
+}
+
+// nodeCount returns the number of nodes of the group of pod.
+func (e *Extender) nodeCount(pod *Pod) (uint32, error) {
+	if pod == nil {
+		return 1, nil
+	}
+	value, ok := pod.Metadata.Annotations[e.config.NodeCountAnnotation]
+	if !ok {
+		return 1, nil
+	}
+	count, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || count == 0 {
+		return 0, fmt.Errorf("invalid %s annotation %q of pod %s/%s",
+			e.config.NodeCountAnnotation, value, pod.Metadata.Namespace, pod.Metadata.Name)
+	}
+	return uint32(count), nil
+}
+
+/* Return the topology names of the candidates in the topology */
+func _known_nodes(candidates []candidate) []string {
+	known := []string{}
+	for _, c := range candidates {
+		if c.topo_name != "" {
+			known = append(known, c.topo_name)
+		}
+	}
+	return known
+}
+
+// Filter keeps the candidate nodes of the topology that can host the group
+// of the pod, on a shared network: under the top switch of the group, or in
+// its blocks for a block topology.
+func (e *Extender) Filter(args *ExtenderArgs) *ExtenderFilterResult {
+	result := &ExtenderFilterResult{
+		FailedNodes:                FailedNodesMap{},
+		FailedAndUnresolvableNodes: FailedNodesMap{},
+	}
+	count, err := e.nodeCount(args.Pod)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	candidates := e.candidates(args)
+	for _, c := range candidates {
+		if c.topo_name == "" {
+			result.FailedAndUnresolvableNodes[c.name] = "node is not in the topology"
+		}
+	}
+
+	known := _known_nodes(candidates)
+	if count > 1 && len(known) > 0 {
+		selection, err := e.topo.Eval(known, nil, count)
+		blocks := []string{}
+		if err == nil && e.topo.Plugin() == tree.PluginBlock {
+			for _, block := range selection.LeafSwitches {
+				blocks = append(blocks, block.Name)
+			}
+		}
+		for _, c := range candidates {
+			switch {
+			case c.topo_name == "":
+			case err != nil:
+				result.FailedNodes[c.name] = fmt.Sprintf("not enough nodes for a group of %d", count)
+			case len(blocks) > 0 && !e._in_groups(blocks, c.topo_name):
+				result.FailedNodes[c.name] = fmt.Sprintf("node is not in block %s", strings.Join(blocks, ", "))
+			case selection.TopSwitch != "" && !e.group_nodes[selection.TopSwitch][c.topo_name]:
+				result.FailedNodes[c.name] = fmt.Sprintf("node is not connected to switch %s", selection.TopSwitch)
+			}
+		}
+	}
+
+	if args.Nodes != nil {
+		result.Nodes = &NodeList{Items: []Node{}}
+		for _, node := range args.Nodes.Items {
+			if _, ok := result.FailedNodes[node.Metadata.Name]; ok {
+				continue
+			}
+			if _, ok := result.FailedAndUnresolvableNodes[node.Metadata.Name]; ok {
+				continue
+			}
+			result.Nodes.Items = append(result.Nodes.Items, node)
+		}
+	} else {
+		names := []string{}
+		for _, c := range candidates {
+			if _, ok := result.FailedNodes[c.name]; ok {
+				continue
+			}
+			if _, ok := result.FailedAndUnresolvableNodes[c.name]; ok {
+				continue
+			}
+			names = append(names, c.name)
+		}
+		result.NodeNames = &names
+	}
+	return result
+}
+
+/* Return whether node is in one of the switches or blocks names */
+func (e *Extender) _in_groups(names []string, node string) bool {
+	for _, name := range names {
+		if e.group_nodes[name][node] {
+			return true
+		}
+	}
+	return false
+}
+
+// Prioritize scores the candidate nodes by leaf switch locality: the nodes
+// the tree evaluator selects for the group of the pod, and the other nodes
+// of their leaf switches, score MaxExtenderPriority. Other nodes score one
+// less per link to the closest of those leaf switches, at least 1. Nodes not
+// in the topology, or not connected, score 0.
+func (e *Extender) Prioritize(args *ExtenderArgs) (HostPriorityList, error) {
+	count, err := e.nodeCount(args.Pod)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := e.candidates(args)
+	priorities := make(HostPriorityList, 0, len(candidates))
+	for _, c := range candidates {
+		priorities = append(priorities, HostPriority{Host: c.name})
+	}
+
+	known := _known_nodes(candidates)
+	if len(known) == 0 {
+		return priorities, nil
+	}
+	selection, err := e.topo.Eval(known, nil, min(count, uint32(len(known))))
+	if err != nil {
+		log.Debugf("No selection for a group of %d nodes: %v", count, err)
+		return priorities, nil
+	}
+
+	for i, c := range candidates {
+		if c.topo_name == "" {
+			continue
+		}
+		for _, leaf := range selection.LeafSwitches {
+			var score int64
+			if e.group_nodes[leaf.Name][c.topo_name] {
+				score = MaxExtenderPriority
+			} else if dist, err := e.topo.Distance(c.topo_name, leaf.Name); err == nil {
+				score = max(1, MaxExtenderPriority-int64(dist))
+			}
+			priorities[i].Score = max(priorities[i].Score, score)
+		}
+	}
+	return priorities, nil
+}
+
+/* Decode the ExtenderArgs of a request, answering the error if it fails */
+func _decode_args(w http.ResponseWriter, r *http.Request) *ExtenderArgs {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("method %s not allowed, use POST", r.Method), http.StatusMethodNotAllowed)
+		return nil
+	}
+	var args ExtenderArgs
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&args); err != nil {
+		http.Error(w, fmt.Sprintf("invalid ExtenderArgs: %v", err), http.StatusBadRequest)
+		return nil
+	}
+	return &args
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn("Writing response: ", err)
+	}
+}
+
+func (e *Extender) handleFilter(w http.ResponseWriter, r *http.Request) {
+	args := _decode_args(w, r)
+	if args == nil {
+		return
+	}
+	writeJSON(w, e.Filter(args))
+}
+
+func (e *Extender) handlePrioritize(w http.ResponseWriter, r *http.Request) {
+	args := _decode_args(w, r)
+	if args == nil {
+		return
+	}
+	priorities, err := e.Prioritize(args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, priorities)
+}
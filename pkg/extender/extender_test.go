@@ -0,0 +1,155 @@
+package extender
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+func _new_extender(tb testing.TB, filename string) *Extender {
+	topo, err := tree.Load(filename)
+	require.NoError(tb, err)
+	return New(topo, Config{NodeNameLabel: "topology.slurm/node-name"})
+}
+
+/* Read recorded ExtenderArgs */
+func _read_args(tb testing.TB, name string) []byte {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(tb, err)
+	return data
+}
+
+/* POST body to the verb of e and decode the JSON response into v */
+func _post(tb testing.TB, e *Extender, verb string, body []byte, v any) {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/"+verb, strings.NewReader(string(body))))
+	require.Equal(tb, http.StatusOK, rec.Code, rec.Body.String())
+	require.NoError(tb, json.Unmarshal(rec.Body.Bytes(), v))
+}
+
+func TestExtender_filter(t *testing.T) {
+	e := _new_extender(t, "../../test/topology1.conf")
+
+	var result ExtenderFilterResult
+	_post(t, e, "filter", _read_args(t, "filter_args.json"), &result)
+	require.Empty(t, result.Error)
+	require.Equal(t, FailedNodesMap{"gpu-node-9": "node is not in the topology"}, result.FailedAndUnresolvableNodes)
+	require.Empty(t, result.FailedNodes)
+	require.Len(t, result.Nodes.Items, 5)
+	require.Equal(t, "tu-x1.cluster.local", result.Nodes.Items[0].Metadata.Name)
+	require.Equal(t, "worker-a", result.Nodes.Items[1].Metadata.Name)
+
+	/* Nodes are passed back whole */
+	var raw struct {
+		Nodes struct {
+			Items []map[string]any `json:"items"`
+		} `json:"nodes"`
+	}
+	_post(t, e, "filter", _read_args(t, "filter_args.json"), &raw)
+	require.Contains(t, raw.Nodes.Items[0], "status")
+}
+
+func TestExtender_filter_disjoint(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "topology.conf")
+	require.NoError(t, os.WriteFile(filename, []byte(
+		"SwitchName=s0 Nodes=tux[0-3]\nSwitchName=s1 Nodes=tux[4-5]\n"), 0644))
+	e := _new_extender(t, filename)
+
+	args := &ExtenderArgs{
+		Pod:       &Pod{Metadata: ObjectMeta{Annotations: map[string]string{DefaultNodeCountAnnotation: "3"}}},
+		NodeNames: &[]string{"tux0", "tux1", "tux2", "tux4", "tux5"},
+	}
+	result := e.Filter(args)
+	require.Equal(t, []string{"tux0", "tux1", "tux2"}, *result.NodeNames)
+	require.Equal(t, FailedNodesMap{
+		"tux4": "node is not connected to switch s0",
+		"tux5": "node is not connected to switch s0",
+	}, result.FailedNodes)
+
+	args.Pod.Metadata.Annotations[DefaultNodeCountAnnotation] = "4"
+	result = e.Filter(args)
+	require.Empty(t, *result.NodeNames)
+	require.Len(t, result.FailedNodes, 5)
+
+	args.Pod.Metadata.Annotations[DefaultNodeCountAnnotation] = "many"
+	require.Contains(t, e.Filter(args).Error, "invalid topology.slurm/node-count annotation")
+}
+
+func TestExtender_filter_block(t *testing.T) {
+	e := _new_extender(t, "../../test/block1.conf")
+
+	names := []string{}
+	for _, node := range e.topo.Nodes() {
+		if node != "gb200-001" && node != "gb200-040" {
+			names = append(names, node)
+		}
+	}
+	args := &ExtenderArgs{
+		Pod:       &Pod{Metadata: ObjectMeta{Annotations: map[string]string{DefaultNodeCountAnnotation: "18"}}},
+		NodeNames: &names,
+	}
+	/* b1 and b3 miss a node, the group fits in b2 */
+	result := e.Filter(args)
+	require.Len(t, *result.NodeNames, 18)
+	require.Equal(t, "gb200-019", (*result.NodeNames)[0])
+	require.Len(t, result.FailedNodes, 52)
+	require.Equal(t, "node is not in block b2", result.FailedNodes["gb200-002"])
+	require.Equal(t, "node is not in block b2", result.FailedNodes["gb200-072"])
+
+	/* The group spans the blocks it needs */
+	args.Pod.Metadata.Annotations[DefaultNodeCountAnnotation] = "20"
+	result = e.Filter(args)
+	require.Empty(t, result.Error)
+	require.Len(t, *result.NodeNames, 35)
+	require.Equal(t, "gb200-002", (*result.NodeNames)[0])
+	require.Equal(t, "gb200-036", (*result.NodeNames)[34])
+	require.Len(t, result.FailedNodes, 35)
+	require.Equal(t, "node is not in block b1, b2", result.FailedNodes["gb200-037"])
+
+	args.Pod.Metadata.Annotations[DefaultNodeCountAnnotation] = "71"
+	result = e.Filter(args)
+	require.Empty(t, *result.NodeNames)
+	require.Equal(t, "not enough nodes for a group of 71", result.FailedNodes["gb200-002"])
+}
+
+func TestExtender_prioritize(t *testing.T) {
+	e := _new_extender(t, "../../test/topology1.conf")
+
+	var priorities HostPriorityList
+	_post(t, e, "prioritize", _read_args(t, "prioritize_args.json"), &priorities)
+	require.Equal(t, HostPriorityList{
+		{Host: "tu-x1", Score: 6},
+		{Host: "tu-x3", Score: 6},
+		{Host: "tux5", Score: 10},
+		{Host: "tux6", Score: 10},
+		{Host: "tux7", Score: 10},
+		{Host: "gpu-node-9", Score: 0},
+	}, priorities)
+
+	/* A pair fits on the leaf switch of tux6 and tux7 */
+	var args ExtenderArgs
+	require.NoError(t, json.Unmarshal(_read_args(t, "prioritize_args.json"), &args))
+	args.Pod.Metadata.Annotations[DefaultNodeCountAnnotation] = "2"
+	priorities, err := e.Prioritize(&args)
+	require.NoError(t, err)
+	require.Equal(t, HostPriorityList{
+		{Host: "tu-x1", Score: 6},
+		{Host: "tu-x3", Score: 6},
+		{Host: "tux5", Score: 8},
+		{Host: "tux6", Score: 10},
+		{Host: "tux7", Score: 10},
+		{Host: "gpu-node-9", Score: 0},
+	}, priorities)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/prioritize", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
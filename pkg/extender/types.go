@@ -0,0 +1,85 @@
+package extender
+
+import (
+	"encoding/json"
+	"slices"
+)
+
+// The types below follow the JSON encoding of k8s.io/kube-scheduler/extender/v1
+// and k8s.io/api/core/v1, keeping only the fields the extender reads.
+
+// MaxExtenderPriority is the highest score of a node.
+const MaxExtenderPriority int64 = 10
+
+// ObjectMeta is the metadata of a pod or node.
+type ObjectMeta struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Pod is the pod being scheduled.
+type Pod struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// Node is a candidate node. It encodes back to the JSON it was decoded from,
+// so nodes passed back to the scheduler keep all their fields.
+type Node struct {
+	Metadata ObjectMeta `json:"metadata"`
+	raw      json.RawMessage
+}
+
+// UnmarshalJSON decodes a node, keeping its JSON encoding.
+func (n *Node) UnmarshalJSON(data []byte) error {
+	type node Node
+	if err := json.Unmarshal(data, (*node)(n)); err != nil {
+		return err
+	}
+	n.raw = slices.Clone(data)
+	return nil
+}
+
+// MarshalJSON encodes a node as it was decoded.
+func (n Node) MarshalJSON() ([]byte, error) {
+	if n.raw != nil {
+		return n.raw, nil
+	}
+	type node Node
+	return json.Marshal(node(n))
+}
+
+// NodeList is a list of candidate nodes.
+type NodeList struct {
+	Items []Node `json:"items"`
+}
+
+// ExtenderArgs is the body of a filter or prioritize request. The scheduler
+// sends either Nodes or, if the extender is nodeCacheCapable, NodeNames.
+type ExtenderArgs struct {
+	Pod       *Pod      `json:"pod"`
+	Nodes     *NodeList `json:"nodes,omitempty"`
+	NodeNames *[]string `json:"nodenames,omitempty"`
+}
+
+// FailedNodesMap maps the nodes filtered out to the reason why.
+type FailedNodesMap map[string]string
+
+// ExtenderFilterResult is the response to a filter request.
+type ExtenderFilterResult struct {
+	Nodes                      *NodeList      `json:"nodes,omitempty"`
+	NodeNames                  *[]string      `json:"nodenames,omitempty"`
+	FailedNodes                FailedNodesMap `json:"failedNodes,omitempty"`
+	FailedAndUnresolvableNodes FailedNodesMap `json:"failedAndUnresolvableNodes,omitempty"`
+	Error                      string         `json:"error,omitempty"`
+}
+
+// HostPriority is the score of a node.
+type HostPriority struct {
+	Host  string `json:"host"`
+	Score int64  `json:"score"`
+}
+
+// HostPriorityList is the response to a prioritize request.
+type HostPriorityList []HostPriority
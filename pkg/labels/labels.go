@@ -0,0 +1,172 @@
+// Package labels generates the Kubernetes node labels describing where nodes
+// are in a topology, for the schedulers that read topology from node labels.
+package labels
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// DefaultKeys are the label keys of the switch levels, from the leaf switches
+// up.
+var DefaultKeys = []string{
+	"topology.example/leaf",
+	"topology.example/spine",
+	"topology.example/core",
+}
+
+// ErrInvalidValue is returned when a switch or block name is not a valid
+// label value.
+var ErrInvalidValue = errors.New("invalid label value")
+
+/* Label values are at most 63 alphanumeric, '-', '_' or '.' characters */
+var valueRegexp = regexp.MustCompile(`^([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]$`)
+
+// NodeLabels are the topology labels of a node.
+type NodeLabels struct {
+	Node   string
+	Labels map[string]string
+}
+
+// Generate returns the labels of each node of topo, in selection order. The
+// switch of level i of the path of a node, see tree.Topology.SwitchPath, is
+// the value of label keys[i]. Levels without a key are not labelled. The
+// block of a node of a block topology is the value of keys[0].
+func Generate(topo *tree.Topology, keys []string) ([]NodeLabels, error) {
+	levels := map[string]int{}
+	for _, sw := range topo.Switches() {
+		levels[sw.Name] = sw.Level
+	}
+	blocks := map[string]string{}
+	for _, block := range topo.Blocks() {
+		for _, node := range block.Nodes {
+			blocks[node] = block.Name
+		}
+	}
+
+	result := []NodeLabels{}
+	for _, node := range topo.Nodes() {
+		labels := map[string]string{}
+		if block, ok := blocks[node]; ok && len(keys) > 0 {
+			labels[keys[0]] = block
+		}
+		path, err := topo.SwitchPath(node)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range path {
+			if level := levels[name]; level < len(keys) && keys[level] != "" {
+				labels[keys[level]] = name
+			}
+		}
+		for _, value := range labels {
+			if len(value) > 63 || !valueRegexp.MatchString(value) {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidValue, value)
+			}
+		}
+		result = append(result, NodeLabels{Node: node, Labels: labels})
+	}
+	return result, nil
+}
+
+/* Return the label keys of labels in order */
+func _sorted_keys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// WriteKubectl writes a shell script labelling the nodes with kubectl.
+func WriteKubectl(w io.Writer, nodes []NodeLabels) error {
+	if _, err := fmt.Fprintln(w, "#!/bin/sh\nset -e"); err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		if len(node.Labels) == 0 {
+			continue
+		}
+		args := []string{"kubectl", "label", "node", node.Node, "--overwrite"}
+		for _, key := range _sorted_keys(node.Labels) {
+			args = append(args, key+"="+node.Labels[key])
+		}
+		if _, err := fmt.Fprintln(w, strings.Join(args, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PatchOperation is a JSON patch (RFC 6902) operation.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// NodePatch is the JSON patch labelling a node.
+type NodePatch struct {
+	Node  string           `json:"node"`
+	Patch []PatchOperation `json:"patch"`
+}
+
+// WriteJSONPatch writes the list of JSON patches labelling the nodes, each to
+// be applied with kubectl patch node NODE --type=json.
+func WriteJSONPatch(w io.Writer, nodes []NodeLabels) error {
+	/* '~' and '/' are escaped in JSON pointers */
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	patches := []NodePatch{}
+	for _, node := range nodes {
+		patch := NodePatch{Node: node.Node, Patch: []PatchOperation{}}
+		for _, key := range _sorted_keys(node.Labels) {
+			patch.Patch = append(patch.Patch, PatchOperation{
+				Op:    "add",
+				Path:  "/metadata/labels/" + escaper.Replace(key),
+				Value: node.Labels[key],
+			})
+		}
+		patches = append(patches, patch)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(patches)
+}
+
+type manifestMetadata struct {
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+}
+
+type manifest struct {
+	APIVersion string           `yaml:"apiVersion"`
+	Kind       string           `yaml:"kind"`
+	Metadata   manifestMetadata `yaml:"metadata"`
+}
+
+// WriteManifests writes a Node manifest with the labels of each node, to be
+// applied with kubectl apply.
+func WriteManifests(w io.Writer, nodes []NodeLabels) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	for _, node := range nodes {
+		if err := enc.Encode(&manifest{
+			APIVersion: "v1",
+			Kind:       "Node",
+			Metadata:   manifestMetadata{Name: node.Node, Labels: node.Labels},
+		}); err != nil {
+			return err
+		}
+	}
+	return enc.Close()
+}
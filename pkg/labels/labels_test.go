@@ -0,0 +1,76 @@
+package labels
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+func TestGenerate(t *testing.T) {
+	topo, err := tree.Load("../../test/topology1.conf")
+	require.NoError(t, err)
+
+	nodes, err := Generate(topo, DefaultKeys)
+	require.NoError(t, err)
+	require.Len(t, nodes, 8)
+	require.Equal(t, NodeLabels{Node: "tux5", Labels: map[string]string{
+		"topology.example/leaf":  "s2",
+		"topology.example/spine": "s5",
+		"topology.example/core":  "s6",
+	}}, nodes[5])
+
+	/* Levels without a key are not labelled */
+	nodes, err = Generate(topo, []string{"rack", "", ""})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"rack": "s0"}, nodes[0].Labels)
+
+	topo, err = tree.Load("../../test/block1.conf")
+	require.NoError(t, err)
+	nodes, err = Generate(topo, []string{"nvlink"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"nvlink": "b1"}, nodes[0].Labels)
+
+	filename := filepath.Join(t.TempDir(), "topology.conf")
+	require.NoError(t, os.WriteFile(filename, []byte("SwitchName=leaf:0 Nodes=tux[0-1]\n"), 0644))
+	topo, err = tree.Load(filename)
+	require.NoError(t, err)
+	_, err = Generate(topo, DefaultKeys)
+	require.ErrorIs(t, err, ErrInvalidValue)
+}
+
+func TestWrite(t *testing.T) {
+	nodes := []NodeLabels{
+		{Node: "tux0", Labels: map[string]string{"topology.example/spine": "s4", "topology.example/leaf": "s0"}},
+		{Node: "tux1", Labels: map[string]string{}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKubectl(&buf, nodes))
+	require.Equal(t, `#!/bin/sh
+set -e
+kubectl label node tux0 --overwrite topology.example/leaf=s0 topology.example/spine=s4
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteJSONPatch(&buf, nodes[:1]))
+	require.JSONEq(t, `[{"node": "tux0", "patch": [
+		{"op": "add", "path": "/metadata/labels/topology.example~1leaf", "value": "s0"},
+		{"op": "add", "path": "/metadata/labels/topology.example~1spine", "value": "s4"}
+	]}]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteManifests(&buf, nodes[:1]))
+	require.Equal(t, `apiVersion: v1
+kind: Node
+metadata:
+  name: tux0
+  labels:
+    topology.example/leaf: s0
+    topology.example/spine: s4
+`, buf.String())
+}
@@ -0,0 +1,94 @@
+// Package result describes node selections, or why they failed, as the
+// documents written by the command line and answered by the server.
+package result
+
+import (
+	"errors"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// Error codes of a selection, also used as exit status by the command line.
+const (
+	CodeSuccess = 0
+	// CodeConfig is returned when the topology configuration can not be loaded.
+	CodeConfig = 1
+	// CodeRequest is returned when the request names invalid or unknown nodes.
+	CodeRequest = 2
+	// CodeNoSelection is returned when no nodes can be selected for the request.
+	CodeNoSelection = 3
+)
+
+// SwitchNodes is the share of a selection connected to one leaf switch or
+// block.
+type SwitchNodes struct {
+	Name      string   `json:"name" yaml:"name"`
+	Hostlist  string   `json:"hostlist" yaml:"hostlist"`
+	Nodes     []string `json:"nodes" yaml:"nodes"`
+	NodeCount int      `json:"node_count" yaml:"node_count"`
+}
+
+// Select is the document describing a selection, or why it failed.
+type Select struct {
+	Nodes           []string          `json:"nodes" yaml:"nodes"`
+	Hostlist        string            `json:"hostlist" yaml:"hostlist"`
+	LeafSwitchCount int               `json:"leaf_switch_count" yaml:"leaf_switch_count"`
+	TopSwitch       string            `json:"top_switch,omitempty" yaml:"top_switch,omitempty"`
+	Switches        []SwitchNodes     `json:"switches,omitempty" yaml:"switches,omitempty"`
+	Blocks          []SwitchNodes     `json:"blocks,omitempty" yaml:"blocks,omitempty"`
+	SwitchesDist    map[string]uint32 `json:"switches_dist,omitempty" yaml:"switches_dist,omitempty"`
+	Trace           *tree.Trace       `json:"trace,omitempty" yaml:"-"`
+	ErrorCode       int               `json:"error_code" yaml:"error_code"`
+	Error           string            `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ErrorCode returns the error code of an error of a selection.
+func ErrorCode(err error) int {
+	switch {
+	case err == nil:
+		return CodeSuccess
+	case errors.Is(err, tree.ErrEvalFailed):
+		return CodeNoSelection
+	case errors.Is(err, tree.ErrUnknownNode), errors.Is(err, hostlist.ErrInvalid):
+		return CodeRequest
+	default:
+		return CodeConfig
+	}
+}
+
+// New describes a selection from topo.
+func New(topo *tree.Topology, selection *tree.Selection) *Select {
+	result := &Select{
+		Nodes:           selection.Nodes,
+		Hostlist:        hostlist.Compress(selection.Nodes),
+		LeafSwitchCount: selection.LeafSwitchCount(),
+		TopSwitch:       selection.TopSwitch,
+		SwitchesDist:    selection.SwitchesDist,
+	}
+
+	groups := []SwitchNodes{}
+	for _, leaf := range selection.LeafSwitches {
+		groups = append(groups, SwitchNodes{
+			Name:      leaf.Name,
+			Hostlist:  hostlist.Compress(leaf.Nodes),
+			Nodes:     leaf.Nodes,
+			NodeCount: len(leaf.Nodes),
+		})
+	}
+	if topo.Plugin() == tree.PluginBlock {
+		result.Blocks = groups
+	} else {
+		result.Switches = groups
+	}
+	return result
+}
+
+// NewError describes a selection that failed with err.
+func NewError(err error) *Select {
+	return &Select{
+		Nodes:     []string{},
+		ErrorCode: ErrorCode(err),
+		Error:     err.Error(),
+	}
+}
@@ -0,0 +1,501 @@
+// Package server answers topology-aware node selection queries over HTTP, so
+// that schedulers not written in Go can use a topology loaded once.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/result"
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+// maxRequestSize bounds the size of a request body.
+const maxRequestSize = 1 << 20
+
+// ShutdownTimeout is how long Serve waits for requests in progress when its
+// context is done.
+var ShutdownTimeout = 10 * time.Second
+
+// SelectRequest is the body of a POST /v1/select request.
+type SelectRequest struct {
+	// Topology is the name of the topology, optional if only one is served
+	// or a default topology is.
+	Topology string `json:"topology"`
+	// Partition selects the topology of a partition instead of Topology.
+	Partition string `json:"partition"`
+	// AvailableNodes and RequiredNodes are hostlist expressions.
+	AvailableNodes     []string `json:"available_nodes"`
+	RequiredNodes      []string `json:"required_nodes"`
+	RequestedNodeCount uint32   `json:"requested_node_count"`
+	// Explain adds the trace of the selection decisions to the result.
+	Explain bool `json:"explain"`
+}
+
+// ValidateResult is the document of a /v1/validate request.
+type ValidateResult struct {
+	Topology    string   `json:"topology"`
+	Plugin      string   `json:"plugin"`
+	Valid       bool     `json:"valid"`
+	Diagnostics []string `json:"diagnostics"`
+	SwitchCount int      `json:"switch_count"`
+	BlockCount  int      `json:"block_count"`
+	NodeCount   int      `json:"node_count"`
+}
+
+// ShowSwitch is a switch of a GET /v1/show document.
+type ShowSwitch struct {
+	Name      string `json:"name"`
+	Level     int    `json:"level"`
+	LinkSpeed uint32 `json:"link_speed"`
+	Parent    string `json:"parent,omitempty"`
+	Switches  string `json:"switches,omitempty"`
+	Nodes     string `json:"nodes"`
+}
+
+// ShowBlock is a block of a GET /v1/show document.
+type ShowBlock struct {
+	Name      string `json:"name"`
+	Nodes     string `json:"nodes"`
+	BlockSize int    `json:"block_size"`
+}
+
+// ShowResult is the document of a GET /v1/show request.
+type ShowResult struct {
+	Topology string       `json:"topology"`
+	Plugin   string       `json:"plugin"`
+	Switches []ShowSwitch `json:"switches,omitempty"`
+	Blocks   []ShowBlock  `json:"blocks,omitempty"`
+}
+
+// DistanceResult is the document of a GET /v1/distance request.
+type DistanceResult struct {
+	Topology  string `json:"topology"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Reachable bool   `json:"reachable"`
+	Distance  uint32 `json:"distance"`
+}
+
+// HealthResult is the document of a GET /healthz request.
+type HealthResult struct {
+	Status     string   `json:"status"`
+	Topologies []string `json:"topologies"`
+}
+
+type errorResult struct {
+	Error string `json:"error"`
+}
+
+// Server answers queries on topologies loaded beforehand. It is safe for
+// concurrent use, as topologies are not modified once loaded.
+type Server struct {
+	topologies  map[string]*tree.Topology
+	names       []string
+	defaultName string            /* topology of queries without one */
+	partitions  map[string]string /* topology name of each partition */
+	mux         *http.ServeMux
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithDefault makes the queries that name no topology use the topology
+// called name, such as the cluster default topology of a topology.yaml file.
+func WithDefault(name string) Option {
+	return func(s *Server) {
+		s.defaultName = name
+	}
+}
+
+// WithPartitions lets queries select a topology by partition, given the
+// topology name of each partition as tree.LoadPartitionTopologies returns.
+// Partitions mapped to an empty name use the default topology.
+func WithPartitions(partitions map[string]string) Option {
+	return func(s *Server) {
+		s.partitions = partitions
+	}
+}
+
+// New returns a Server answering queries on topologies, by name. A nil
+// topology is flat, such as a flat topology of a topology.yaml file: it has
+// no switches, so queries on it are answered an error.
+func New(topologies map[string]*tree.Topology, opts ...Option) *Server {
+	s := &Server{
+		topologies: topologies,
+		names:      make([]string, 0, len(topologies)),
+		partitions: map[string]string{},
+		mux:        http.NewServeMux(),
+	}
+	for name := range topologies {
+		s.names = append(s.names, name)
+	}
+	sort.Strings(s.names)
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	s.mux.HandleFunc("/v1/select", s.handleSelect)
+	s.mux.HandleFunc("/v1/validate", s.handleValidate)
+	s.mux.HandleFunc("/v1/show", s.handleShow)
+	s.mux.HandleFunc("/v1/distance", s.handleDistance)
+	return s
+}
+
+// ServeHTTP routes a request to its endpoint.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Serve answers requests accepted on l until ctx is done, then shuts down
+// gracefully, waiting up to ShutdownTimeout for requests in progress.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	return Serve(ctx, l, s)
+}
+
+// Serve answers requests accepted on l with h until ctx is done, then shuts
+// down gracefully, waiting up to ShutdownTimeout for requests in progress.
+func Serve(ctx context.Context, l net.Listener, h http.Handler) error {
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.Serve(l)
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn("Writing response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResult{Error: err.Error()})
+}
+
+// allowMethod answers 405 and returns false unless r uses one of methods.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	if slices.Contains(methods, r.Method) {
+		return true
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed, use %s", r.Method, strings.Join(methods, " or ")))
+	return false
+}
+
+// topology returns the topology called name, or the topology of partition.
+// Without either, it returns the default topology, or the only one served.
+// It answers the error and returns nil if there is none.
+func (s *Server) topology(w http.ResponseWriter, name, partition string) (*tree.Topology, string) {
+	if partition != "" {
+		if name != "" {
+			writeError(w, http.StatusBadRequest, errors.New("topology and partition are mutually exclusive"))
+			return nil, ""
+		}
+		partitionTopology, ok := s.partitions[partition]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown partition %q", partition))
+			return nil, ""
+		}
+		name = partitionTopology
+	}
+	if name == "" {
+		if s.defaultName != "" {
+			name = s.defaultName
+		} else if len(s.names) == 1 {
+			return s.topologies[s.names[0]], s.names[0]
+		}
+	}
+	if name == "" {
+		writeError(w, http.StatusBadRequest,
+			fmt.Errorf("topology is required, one of %s", strings.Join(s.names, ", ")))
+		return nil, ""
+	}
+	topo, ok := s.topologies[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown topology %q", name))
+		return nil, ""
+	}
+	if topo == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("topology %q is flat, it has no switches", name))
+		return nil, ""
+	}
+	return topo, name
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	writeJSON(w, http.StatusOK, &HealthResult{Status: "ok", Topologies: s.names})
+}
+
+func (s *Server) handleSelect(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req SelectRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return
+	}
+	topo, _ := s.topology(w, req.Topology, req.Partition)
+	if topo == nil {
+		return
+	}
+
+	res, err := s.eval(topo, &req)
+	switch result.ErrorCode(err) {
+	case result.CodeSuccess:
+		writeJSON(w, http.StatusOK, res)
+	case result.CodeNoSelection:
+		writeJSON(w, http.StatusUnprocessableEntity, res)
+	default:
+		writeJSON(w, http.StatusBadRequest, res)
+	}
+}
+
+// eval selects nodes of topo for req.
+func (s *Server) eval(topo *tree.Topology, req *SelectRequest) (*result.Select, error) {
+	available, err := hostlist.ExpandAll(req.AvailableNodes)
+	if err != nil {
+		return result.NewError(err), err
+	}
+	required, err := hostlist.ExpandAll(req.RequiredNodes)
+	if err != nil {
+		return result.NewError(err), err
+	}
+
+	opts := []tree.EvalOption{}
+	var trace *tree.Trace
+	if req.Explain {
+		trace = &tree.Trace{}
+		opts = append(opts, tree.WithTrace(trace))
+	}
+	selection, err := topo.Eval(available, required, req.RequestedNodeCount, opts...)
+	var res *result.Select
+	if err == nil {
+		res = result.New(topo, selection)
+	} else {
+		res = result.NewError(err)
+	}
+	if trace != nil && (err == nil || errors.Is(err, tree.ErrEvalFailed)) {
+		res.Trace = trace
+	}
+	return res, err
+}
+
+func (s *Server) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodPost) {
+		return
+	}
+	if r.Method == http.MethodPost {
+		s.validateBody(w, r)
+		return
+	}
+	topo, name := s.topology(w, r.URL.Query().Get("topology"), r.URL.Query().Get("partition"))
+	if topo == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, newValidateResult(topo, name))
+}
+
+// validateBody validates the topology.conf of the body of r, or its
+// topology.yaml with format=yaml, as the validate command does. Problems of
+// the configuration are answered as diagnostics of an invalid topology.
+func (s *Server) validateBody(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	opts := []tree.LoadOption{}
+	plugin := query.Get("plugin")
+	if plugin != "" && !strings.Contains(plugin, "/") {
+		plugin = "topology/" + plugin
+	}
+	if plugin != "" {
+		opts = append(opts, tree.WithPlugin(plugin))
+	}
+	if strict, _ := strconv.ParseBool(query.Get("strict")); strict {
+		opts = append(opts, tree.WithStrict())
+	}
+	body := http.MaxBytesReader(w, r.Body, maxRequestSize)
+
+	var topo *tree.Topology
+	var err error
+	name := query.Get("topology")
+	switch format := query.Get("format"); format {
+	case "", "conf":
+		topo, err = tree.LoadReader(body, "topology.conf", opts...)
+	case "yaml":
+		var topologies tree.Topologies
+		topologies, err = tree.LoadYAMLReader(body, "topology.yaml", opts...)
+		if err == nil {
+			var nt *tree.NamedTopology
+			if nt, err = topologies.Find(name); err == nil {
+				topo, name = nt.Topology, nt.Name
+			}
+		}
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("unknown format %q, expected conf or yaml", format))
+		return
+	}
+
+	var validationErr *tree.ValidationError
+	var configErr *tree.ConfigError
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, newValidateResult(topo, name))
+		return
+	case errors.As(err, &maxBytesErr), errors.Is(err, tree.ErrUnknownPlugin),
+		errors.Is(err, tree.ErrUnknownTopology), errors.Is(err, tree.ErrFlatTopology):
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if plugin == "" {
+		plugin = tree.PluginTree
+	}
+	result := &ValidateResult{Topology: name, Plugin: plugin, Diagnostics: []string{}}
+	switch {
+	case errors.As(err, &validationErr):
+		for _, diag := range validationErr.Diagnostics {
+			result.Diagnostics = append(result.Diagnostics, diag.Error())
+		}
+	case errors.As(err, &configErr):
+		result.Diagnostics = append(result.Diagnostics, configErr.Error())
+	default:
+		result.Diagnostics = append(result.Diagnostics, err.Error())
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// newValidateResult describes topo, valid if loading it found no problems.
+func newValidateResult(topo *tree.Topology, name string) *ValidateResult {
+	result := &ValidateResult{
+		Topology:    name,
+		Plugin:      topo.Plugin(),
+		Diagnostics: []string{},
+		SwitchCount: len(topo.Switches()),
+		BlockCount:  len(topo.Blocks()),
+		NodeCount:   len(topo.Nodes()),
+	}
+	for _, diag := range topo.Diagnostics() {
+		result.Diagnostics = append(result.Diagnostics, diag.Error())
+	}
+	result.Valid = len(result.Diagnostics) == 0
+	return result
+}
+
+func (s *Server) handleShow(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	query := r.URL.Query()
+	topo, name := s.topology(w, query.Get("topology"), query.Get("partition"))
+	if topo == nil {
+		return
+	}
+	names := query["name"]
+
+	result := &ShowResult{Topology: name, Plugin: topo.Plugin()}
+	if topo.Plugin() == tree.PluginBlock {
+		result.Blocks = []ShowBlock{}
+		for _, block := range topo.Blocks() {
+			if len(names) > 0 && !slices.Contains(names, block.Name) {
+				continue
+			}
+			result.Blocks = append(result.Blocks, ShowBlock{
+				Name:      block.Name,
+				Nodes:     hostlist.Compress(block.Nodes),
+				BlockSize: len(block.Nodes),
+			})
+		}
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	result.Switches = []ShowSwitch{}
+	for _, sw := range topo.Switches() {
+		if len(names) > 0 && !slices.Contains(names, sw.Name) {
+			continue
+		}
+		result.Switches = append(result.Switches, ShowSwitch{
+			Name:      sw.Name,
+			Level:     sw.Level,
+			LinkSpeed: sw.LinkSpeed,
+			Parent:    sw.Parent,
+			Switches:  hostlist.Compress(sw.Switches),
+			Nodes:     hostlist.Compress(sw.Nodes),
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleDistance(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	query := r.URL.Query()
+	topo, name := s.topology(w, query.Get("topology"), query.Get("partition"))
+	if topo == nil {
+		return
+	}
+	from, to := query.Get("from"), query.Get("to")
+	if from == "" || to == "" {
+		writeError(w, http.StatusBadRequest, errors.New("from and to are required"))
+		return
+	}
+
+	result := &DistanceResult{Topology: name, From: from, To: to}
+	dist, err := topo.Distance(from, to)
+	switch {
+	case err == nil:
+		result.Reachable = true
+		result.Distance = dist
+	case errors.Is(err, tree.ErrUnreachable):
+	case errors.Is(err, tree.ErrUnknownName):
+		writeError(w, http.StatusNotFound, err)
+		return
+	default:
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/result"
+	"github.com/yeahdongcn/topology/pkg/slurm/topology/tree"
+)
+
+func _new_server(tb testing.TB, files map[string]string) *Server {
+	topologies := map[string]*tree.Topology{}
+	for name, file := range files {
+		topo, err := tree.Load("../../test/" + file)
+		require.NoError(tb, err)
+		topologies[name] = topo
+	}
+	return New(topologies)
+}
+
+/* Send a request to s and decode the JSON response into v */
+func _do(tb testing.TB, s *Server, method, target, body string, v any) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	require.Equal(tb, "application/json", rec.Header().Get("Content-Type"))
+	require.NoError(tb, json.Unmarshal(rec.Body.Bytes(), v))
+	return rec.Code
+}
+
+func TestServer_health(t *testing.T) {
+	s := _new_server(t, map[string]string{"tree": "topology1.conf", "block": "block1.conf"})
+
+	var health HealthResult
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodGet, "/healthz", "", &health))
+	require.Equal(t, HealthResult{Status: "ok", Topologies: []string{"block", "tree"}}, health)
+
+	var e errorResult
+	require.Equal(t, http.StatusMethodNotAllowed, _do(t, s, http.MethodPost, "/healthz", "", &e))
+}
+
+func TestServer_select(t *testing.T) {
+	s := _new_server(t, map[string]string{"tree": "topology1.conf", "block": "block1.conf"})
+
+	var res result.Select
+	code := _do(t, s, http.MethodPost, "/v1/select",
+		`{"topology": "tree", "available_nodes": ["tu-x1,tu-x3,tux[5-7]"], "requested_node_count": 3, "explain": true}`, &res)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "tux[5-7]", res.Hostlist)
+	require.Equal(t, "s6", res.TopSwitch)
+	require.Equal(t, 2, res.LeafSwitchCount)
+	require.NotNil(t, res.Trace)
+	require.Equal(t, "request satisfied from leaf switch s2", res.Trace.StopReason)
+
+	res = result.Select{}
+	code = _do(t, s, http.MethodPost, "/v1/select",
+		`{"topology": "block", "available_nodes": ["gb200-[001-072]"], "requested_node_count": 20}`, &res)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, res.Blocks, 2)
+	require.Nil(t, res.Trace)
+
+	for _, tc := range []struct {
+		body   string
+		status int
+		code   int
+	}{
+		{`{"topology": "tree", "available_nodes": ["tux[4-7]"], "requested_node_count": 9}`,
+			http.StatusUnprocessableEntity, result.CodeNoSelection},
+		{`{"topology": "tree", "available_nodes": ["tux[4-7]"], "required_nodes": ["tux9"], "requested_node_count": 2}`,
+			http.StatusBadRequest, result.CodeRequest},
+		{`{"topology": "tree", "available_nodes": ["tux[4-"], "requested_node_count": 2}`,
+			http.StatusBadRequest, result.CodeRequest},
+	} {
+		res = result.Select{}
+		require.Equal(t, tc.status, _do(t, s, http.MethodPost, "/v1/select", tc.body, &res), tc.body)
+		require.Equal(t, tc.code, res.ErrorCode, tc.body)
+		require.NotEmpty(t, res.Error, tc.body)
+	}
+
+	var e errorResult
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodPost, "/v1/select",
+		`{"available_nodes": ["tux[4-7]"], "requested_node_count": 2}`, &e))
+	require.Equal(t, "topology is required, one of block, tree", e.Error)
+	require.Equal(t, http.StatusNotFound, _do(t, s, http.MethodPost, "/v1/select",
+		`{"topology": "dfly", "requested_node_count": 2}`, &e))
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodPost, "/v1/select",
+		`{"topology": "tree", "count": 2}`, &e))
+	require.Equal(t, http.StatusMethodNotAllowed, _do(t, s, http.MethodGet, "/v1/select", "", &e))
+}
+
+func TestServer_validate_show(t *testing.T) {
+	s := _new_server(t, map[string]string{"tree": "topology1.conf"})
+
+	var validate ValidateResult
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodGet, "/v1/validate", "", &validate))
+	require.Equal(t, ValidateResult{
+		Topology:    "tree",
+		Plugin:      tree.PluginTree,
+		Valid:       true,
+		Diagnostics: []string{},
+		SwitchCount: 7,
+		NodeCount:   8,
+	}, validate)
+
+	var show ShowResult
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodGet, "/v1/show?topology=tree&name=s5", "", &show))
+	require.Equal(t, []ShowSwitch{{
+		Name:     "s5",
+		Level:    1,
+		Parent:   "s6",
+		Switches: "s[2-3]",
+		Nodes:    "tux[4-7]",
+	}}, show.Switches)
+}
+
+func TestServer_validate_body(t *testing.T) {
+	s := _new_server(t, map[string]string{"tree": "topology1.conf"})
+
+	var validate ValidateResult
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate",
+		"SwitchName=s0 Nodes=tux[0-1]\nSwitchName=s1 Switches=s0\n", &validate))
+	require.Equal(t, ValidateResult{
+		Plugin:      tree.PluginTree,
+		Valid:       true,
+		Diagnostics: []string{},
+		SwitchCount: 2,
+		NodeCount:   2,
+	}, validate)
+
+	body := "SwitchName=s0 Nodes=tux[0-1] LinkSpeed=fast\nSwitchName=s1 Switches=s0 Nodes=tux2\n"
+	validate = ValidateResult{}
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate", body, &validate))
+	require.False(t, validate.Valid)
+	require.Equal(t, []string{
+		"topology.conf:1: switch s0: invalid LinkSpeed: fast",
+		"topology.conf:2: switch s1: switch has both child switches and nodes",
+	}, validate.Diagnostics)
+
+	validate = ValidateResult{}
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate?strict=true", body, &validate))
+	require.False(t, validate.Valid)
+	require.Len(t, validate.Diagnostics, 2)
+	require.Zero(t, validate.SwitchCount)
+
+	validate = ValidateResult{}
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate", "SwitchName=s0 Switches=s9\n", &validate))
+	require.Equal(t, ValidateResult{
+		Plugin:      tree.PluginTree,
+		Diagnostics: []string{"topology.conf:1: switch s0: invalid child switch (s9)"},
+	}, validate)
+
+	validate = ValidateResult{}
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate?format=yaml",
+		"- topology: cpu\n  tree:\n    switches:\n      - switch: s0\n        nodes: tux[0-1]\n", &validate))
+	require.Equal(t, "cpu", validate.Topology)
+	require.True(t, validate.Valid)
+
+	validate = ValidateResult{}
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate?format=yaml", "- topology: cpu\n  color: red\n", &validate))
+	require.False(t, validate.Valid)
+	require.Len(t, validate.Diagnostics, 1)
+	require.Contains(t, validate.Diagnostics[0], `topology.yaml: syntax error: line 2: unknown key "color"`)
+
+	validate = ValidateResult{}
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/validate?plugin=block",
+		"BlockName=b0 Nodes=tux[0-3]\nBlockName=b1 Nodes=tux[4-7]\n", &validate))
+	require.Equal(t, tree.PluginBlock, validate.Plugin)
+	require.Equal(t, 2, validate.BlockCount)
+
+	var e errorResult
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodPost, "/v1/validate?format=toml", "", &e))
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodPost, "/v1/validate?plugin=topology/torus", "SwitchName=s0 Nodes=tux0\n", &e))
+	require.Equal(t, http.StatusMethodNotAllowed, _do(t, s, http.MethodPut, "/v1/validate", "", &e))
+	require.Equal(t, "method PUT not allowed, use GET or POST", e.Error)
+}
+
+func TestServer_distance(t *testing.T) {
+	s := _new_server(t, map[string]string{"tree": "topology1.conf"})
+
+	var dist DistanceResult
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodGet, "/v1/distance?from=tux5&to=s0", "", &dist))
+	require.Equal(t, DistanceResult{Topology: "tree", From: "tux5", To: "s0", Reachable: true, Distance: 4}, dist)
+
+	var e errorResult
+	require.Equal(t, http.StatusNotFound, _do(t, s, http.MethodGet, "/v1/distance?from=tux5&to=s9", "", &e))
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodGet, "/v1/distance?from=tux5", "", &e))
+}
+
+func TestServer_partitions(t *testing.T) {
+	named, err := tree.LoadYAML("../../test/topology.yaml")
+	require.NoError(t, err)
+	partitions, err := tree.LoadPartitionTopologies("../../test/slurm.conf")
+	require.NoError(t, err)
+	topologies := map[string]*tree.Topology{}
+	for _, nt := range named {
+		topologies[nt.Name] = nt.Topology
+	}
+	s := New(topologies, WithDefault(named.Default().Name), WithPartitions(partitions))
+
+	var res result.Select
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodPost, "/v1/select",
+		`{"partition": "gpu", "available_nodes": ["gb200-[001-072]"], "requested_node_count": 20}`, &res))
+	require.Len(t, res.Blocks, 2)
+
+	/* The debug partition and queries without a topology use the default */
+	var validate ValidateResult
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodGet, "/v1/validate?partition=debug", "", &validate))
+	require.Equal(t, "cpu", validate.Topology)
+	require.Equal(t, http.StatusOK, _do(t, s, http.MethodGet, "/v1/validate", "", &validate))
+	require.Equal(t, "cpu", validate.Topology)
+
+	var e errorResult
+	require.Equal(t, http.StatusNotFound, _do(t, s, http.MethodGet, "/v1/show?partition=batch", "", &e))
+	require.Equal(t, `unknown partition "batch"`, e.Error)
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodGet, "/v1/show?partition=gpu&topology=gpu", "", &e))
+
+	/* Flat topologies have no switches to answer on */
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodGet, "/v1/validate?partition=login", "", &e))
+	require.Equal(t, `topology "login" is flat, it has no switches`, e.Error)
+	require.Equal(t, http.StatusBadRequest, _do(t, s, http.MethodGet, "/v1/show?topology=login", "", &e))
+}
+
+func TestServer_Serve(t *testing.T) {
+	s := _new_server(t, map[string]string{"tree": "topology1.conf"})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Serve(ctx, l)
+	}()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/healthz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	/* Shutting down is not an error */
+	cancel()
+	require.NoError(t, <-errc)
+}
@@ -0,0 +1,344 @@
+package hostlist
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* Maximum number of hosts a single range may expand to */
+const MAX_RANGE = 64 * 1024
+
+// ErrInvalid is returned when a hostlist expression can not be parsed.
+var ErrInvalid = errors.New("invalid hostlist expression")
+
+/* Separators between hosts of a hostlist expression */
+func _is_sep(c byte) bool {
+	return c == ',' || c == ' ' || c == '\t' || c == '\n'
+}
+
+/*
+ * _split_hosts splits a hostlist expression at every separator that is not
+ * enclosed in brackets.
+ */
+func _split_hosts(expr string) ([]string, error) {
+	hosts := []string{}
+	depth := 0
+	start := 0
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '[':
+			if depth > 0 {
+				return nil, fmt.Errorf("%w: %q: nested brackets", ErrInvalid, expr)
+			}
+			depth++
+		case c == ']':
+			if depth == 0 {
+				return nil, fmt.Errorf("%w: %q: unbalanced brackets", ErrInvalid, expr)
+			}
+			depth--
+		case _is_sep(c) && depth == 0:
+			if i > start {
+				hosts = append(hosts, expr[start:i])
+			}
+			start = i + 1
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: %q: unbalanced brackets", ErrInvalid, expr)
+	}
+	if start < len(expr) {
+		hosts = append(hosts, expr[start:])
+	}
+	return hosts, nil
+}
+
+/*
+ * _parse_range expands the contents of a bracket, e.g. "1-3,5,07-09", into
+ * the list of zero padded numbers it describes.
+ */
+func _parse_range(expr, ranges string) ([]string, error) {
+	nums := []string{}
+	for _, r := range strings.Split(ranges, ",") {
+		lo_str, hi_str, is_range := strings.Cut(r, "-")
+		if !is_range {
+			hi_str = lo_str
+		}
+		lo, err := strconv.ParseUint(lo_str, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: invalid range %q", ErrInvalid, expr, r)
+		}
+		hi, err := strconv.ParseUint(hi_str, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: invalid range %q", ErrInvalid, expr, r)
+		}
+		if lo > hi {
+			return nil, fmt.Errorf("%w: %q: invalid range %q", ErrInvalid, expr, r)
+		}
+		if hi-lo >= MAX_RANGE {
+			return nil, fmt.Errorf("%w: %q: too many hosts in range %q", ErrInvalid, expr, r)
+		}
+
+		/* A leading zero on the lower bound requests zero padding */
+		width := 0
+		if len(lo_str) > 1 && lo_str[0] == '0' {
+			width = len(lo_str)
+		}
+		for i := lo; i <= hi; i++ {
+			nums = append(nums, fmt.Sprintf("%0*d", width, i))
+		}
+	}
+	return nums, nil
+}
+
+/*
+ * _expand_host expands a single host expression that may contain any number
+ * of bracketed ranges, e.g. "r[1-2]n[1-8]-ib". The leftmost range varies
+ * slowest.
+ */
+func _expand_host(expr, host string) ([]string, error) {
+	open := strings.IndexByte(host, '[')
+	if open < 0 {
+		return []string{host}, nil
+	}
+	end := strings.IndexByte(host[open:], ']')
+	if end < 0 {
+		return nil, fmt.Errorf("%w: %q: unbalanced brackets", ErrInvalid, expr)
+	}
+	end += open
+
+	nums, err := _parse_range(expr, host[open+1:end])
+	if err != nil {
+		return nil, err
+	}
+	suffixes, err := _expand_host(expr, host[end+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := host[:open]
+	hosts := make([]string, 0, len(nums)*len(suffixes))
+	for _, num := range nums {
+		for _, suffix := range suffixes {
+			hosts = append(hosts, prefix+num+suffix)
+		}
+	}
+	return hosts, nil
+}
+
+// Expand expands a Slurm hostlist expression such as "tux[0-3],gpu[01-02]"
+// into the individual host names, in the order they appear.
+func Expand(expr string) ([]string, error) {
+	hosts, err := _split_hosts(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("%w: %q: no hosts", ErrInvalid, expr)
+	}
+
+	names := []string{}
+	for _, host := range hosts {
+		expanded, err := _expand_host(expr, host)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, expanded...)
+		if len(names) > MAX_RANGE {
+			return nil, fmt.Errorf("%w: %q: too many hosts", ErrInvalid, expr)
+		}
+	}
+	return names, nil
+}
+
+// ExpandAll expands each of the given hostlist expressions and returns all
+// host names, in the order they appear.
+func ExpandAll(exprs []string) ([]string, error) {
+	names := []string{}
+	for _, expr := range exprs {
+		expanded, err := Expand(expr)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, expanded...)
+	}
+	return names, nil
+}
+
+type hostname_t struct {
+	name   string
+	prefix string /* everything before the numeric suffix */
+	num    uint64 /* numeric suffix */
+	width  int    /* number of digits in the numeric suffix, 0 if none */
+}
+
+func _hostname_create(name string) *hostname_t {
+	hn := &hostname_t{name: name, prefix: name}
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	/* Suffixes too long to be a number are not ranged */
+	num, err := strconv.ParseUint(name[i:], 10, 32)
+	if i == len(name) || err != nil {
+		return hn
+	}
+	hn.prefix = name[:i]
+	hn.num = num
+	hn.width = len(name) - i
+	return hn
+}
+
+/* Whether the numeric suffix was written with leading zeros */
+func (hn *hostname_t) _zero_padded() bool {
+	return hn.width > 1 && hn.name[len(hn.name)-hn.width] == '0'
+}
+
+type hostrange_t struct {
+	lo, hi uint64
+	width  int /* zero padded width, 0 if not padded */
+}
+
+func (hr *hostrange_t) String() string {
+	if hr.lo == hr.hi {
+		return fmt.Sprintf("%0*d", hr.width, hr.lo)
+	}
+	return fmt.Sprintf("%0*d-%0*d", hr.width, hr.lo, hr.width, hr.hi)
+}
+
+/*
+ * _hostrange_extend adds hn to hr if it directly follows the range and
+ * both can be printed with the same zero padding.
+ */
+func (hr *hostrange_t) _hostrange_extend(hn *hostname_t) bool {
+	if hn.num != hr.hi+1 {
+		return false
+	}
+	if hn._zero_padded() {
+		if hr.width == 0 {
+			/* Unpadded numbers must already have the padded width */
+			if len(strconv.FormatUint(hr.lo, 10)) != hn.width {
+				return false
+			}
+			hr.width = hn.width
+		} else if hr.width != hn.width {
+			return false
+		}
+	} else if hr.width != 0 && hr.width != hn.width {
+		return false
+	}
+	hr.hi = hn.num
+	return true
+}
+
+// Compress collapses host names into the canonical, sorted Slurm hostlist
+// expression, e.g. "tux[4-6,12-15],worker[001-004]". Duplicate names are
+// removed.
+func Compress(names []string) string {
+	hosts := make([]*hostname_t, 0, len(names))
+	seen := map[string]struct{}{}
+	for _, name := range names {
+		if _, ok := seen[name]; ok || name == "" {
+			continue
+		}
+		seen[name] = struct{}{}
+		hosts = append(hosts, _hostname_create(name))
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		if c := Compare(hosts[i].prefix, hosts[j].prefix); c != 0 {
+			return c < 0
+		}
+		if (hosts[i].width == 0) != (hosts[j].width == 0) {
+			return hosts[i].width == 0
+		}
+		if hosts[i].num != hosts[j].num {
+			return hosts[i].num < hosts[j].num
+		}
+		return hosts[i].width > hosts[j].width
+	})
+
+	groups := []string{}
+	for i := 0; i < len(hosts); {
+		hn := hosts[i]
+		if hn.width == 0 {
+			groups = append(groups, hn.name)
+			i++
+			continue
+		}
+
+		ranges := []*hostrange_t{}
+		for ; i < len(hosts) && hosts[i].prefix == hn.prefix && hosts[i].width > 0; i++ {
+			if len(ranges) > 0 && ranges[len(ranges)-1]._hostrange_extend(hosts[i]) {
+				continue
+			}
+			hr := &hostrange_t{lo: hosts[i].num, hi: hosts[i].num}
+			if hosts[i]._zero_padded() {
+				hr.width = hosts[i].width
+			}
+			ranges = append(ranges, hr)
+		}
+
+		if len(ranges) == 1 && ranges[0].lo == ranges[0].hi {
+			groups = append(groups, hn.prefix+ranges[0].String())
+			continue
+		}
+		strs := make([]string, 0, len(ranges))
+		for _, hr := range ranges {
+			strs = append(strs, hr.String())
+		}
+		groups = append(groups, hn.prefix+"["+strings.Join(strs, ",")+"]")
+	}
+	return strings.Join(groups, ",")
+}
+
+/* Split off the leading run of digits or non-digits of s */
+func _next_segment(s string) (segment string, rest string, numeric bool) {
+	if s == "" {
+		return "", "", false
+	}
+	numeric = s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == numeric {
+		i++
+	}
+	return s[:i], s[i:], numeric
+}
+
+// Compare compares host names in natural order: the text segments of the
+// names are compared lexically and the numeric segments by value, so that
+// "tux9" sorts before "tux10" and "tu-x1" before "tux0". It returns -1, 0
+// or +1 like strings.Compare.
+func Compare(a, b string) int {
+	for a != "" && b != "" {
+		seg_a, rest_a, num_a := _next_segment(a)
+		seg_b, rest_b, num_b := _next_segment(b)
+		if num_a && num_b {
+			/* Compare by value, ignoring leading zeros */
+			trim_a := strings.TrimLeft(seg_a, "0")
+			trim_b := strings.TrimLeft(seg_b, "0")
+			if len(trim_a) != len(trim_b) {
+				return cmp.Compare(len(trim_a), len(trim_b))
+			}
+			if c := strings.Compare(trim_a, trim_b); c != 0 {
+				return c
+			}
+			/* Same value, the longer zero padding sorts first */
+			if c := cmp.Compare(len(seg_b), len(seg_a)); c != 0 {
+				return c
+			}
+		} else if num_a != num_b {
+			/* Numbers sort before text */
+			if num_a {
+				return -1
+			}
+			return 1
+		} else if c := strings.Compare(seg_a, seg_b); c != 0 {
+			return c
+		}
+		a, b = rest_a, rest_b
+	}
+	return cmp.Compare(len(a), len(b))
+}
@@ -0,0 +1,144 @@
+package hostlist
+
+import (
+	"cmp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"node1", []string{"node1"}},
+		{"node[1]", []string{"node1"}},
+		{"node[1-3,5,7-9]", []string{"node1", "node2", "node3", "node5", "node7", "node8", "node9"}},
+		{"worker[001,134-136]", []string{"worker001", "worker134", "worker135", "worker136"}},
+		{"n[8-11]", []string{"n8", "n9", "n10", "n11"}},
+		{"n[08-11]", []string{"n08", "n09", "n10", "n11"}},
+		{"tux[0-1],gpu[1-2]", []string{"tux0", "tux1", "gpu1", "gpu2"}},
+		{"tux0 tux1\tgpu1", []string{"tux0", "tux1", "gpu1"}},
+		{"rack1n[01-02]", []string{"rack1n01", "rack1n02"}},
+		{"n[1-2]-ib", []string{"n1-ib", "n2-ib"}},
+		{"r[1-2]n[1-2]", []string{"r1n1", "r1n2", "r2n1", "r2n2"}},
+		{"tu-x[0-1],tux[4-5]", []string{"tu-x0", "tu-x1", "tux4", "tux5"}},
+		{"[1-2]", []string{"1", "2"}},
+	}
+	for _, test := range tests {
+		names, err := Expand(test.expr)
+		require.NoError(t, err, test.expr)
+		require.Equal(t, test.expected, names, test.expr)
+	}
+}
+
+func TestExpand_invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		",",
+		"node[1-3",
+		"node1-3]",
+		"node[[1-3]]",
+		"node[]",
+		"node[a-b]",
+		"node[3-1]",
+		"node[1-]",
+		"node[-1]",
+		"node[1,,2]",
+		"node[0-99999999]",
+	} {
+		names, err := Expand(expr)
+		require.ErrorIs(t, err, ErrInvalid, expr)
+		require.Nil(t, names, expr)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	tests := []struct {
+		names    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"tux4"}, "tux4"},
+		{[]string{"worker001"}, "worker001"},
+		{[]string{"tux4", "tux5"}, "tux[4-5]"},
+		{[]string{"tux12", "tux4", "tux5", "tux6", "tux13", "tux14", "tux15"}, "tux[4-6,12-15]"},
+		{[]string{"worker001", "worker002", "worker003", "worker004"}, "worker[001-004]"},
+		{[]string{"worker099", "worker100"}, "worker[099-100]"},
+		{[]string{"n9", "n10", "n11"}, "n[9-11]"},
+		{[]string{"n8", "n09", "n10"}, "n[8,09-10]"},
+		{[]string{"tux1", "tux1", "tux0"}, "tux[0-1]"},
+		{[]string{"gpu2", "tux0", "gpu1", "tux1"}, "gpu[1-2],tux[0-1]"},
+		{[]string{"tu-x0", "tu-x1", "tux4"}, "tu-x[0-1],tux4"},
+		{[]string{"rack1n01", "rack1n02", "rack2n01"}, "rack1n[01-02],rack2n01"},
+		{[]string{"n1-ib", "n2-ib"}, "n1-ib,n2-ib"},
+		{[]string{"login", "tux0"}, "login,tux0"},
+	}
+	for _, test := range tests {
+		require.Equal(t, test.expected, Compress(test.names), test.names)
+	}
+}
+
+func TestCompress_roundtrip(t *testing.T) {
+	for _, expr := range []string{
+		"tux[0-15]",
+		"worker[001-020,065-104]",
+		"n[8,09-10,100]",
+		"gpu[1-2],rack1n[01-04],tux[0-3]",
+	} {
+		names, err := Expand(expr)
+		require.NoError(t, err)
+		require.Equal(t, expr, Compress(names))
+
+		expanded, err := Expand(Compress(names))
+		require.NoError(t, err)
+		require.Equal(t, names, expanded)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	sorted := []string{
+		"",
+		"1",
+		"2",
+		"10",
+		"gpu2",
+		"gpu10",
+		"n01",
+		"n1",
+		"n1-ib",
+		"n2",
+		"n2-ib",
+		"n10",
+		"rack2n1",
+		"rack10n1",
+		"tu-x1",
+		"tu-x10",
+		"tux",
+		"tux0",
+		"tux9",
+		"tux10",
+		"worker001",
+		"worker020",
+		"worker100",
+	}
+	for i := range sorted {
+		for j := range sorted {
+			require.Equal(t, cmp.Compare(i, j), Compare(sorted[i], sorted[j]), "%q %q", sorted[i], sorted[j])
+		}
+	}
+}
+
+func TestExpandAll(t *testing.T) {
+	names, err := ExpandAll([]string{"tux[0-1],gpu1", "tux[4-5]"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux0", "tux1", "gpu1", "tux4", "tux5"}, names)
+
+	names, err = ExpandAll(nil)
+	require.NoError(t, err)
+	require.Empty(t, names)
+
+	_, err = ExpandAll([]string{"tux0", "node[1-3"})
+	require.ErrorIs(t, err, ErrInvalid)
+}
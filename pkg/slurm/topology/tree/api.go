@@ -2,6 +2,9 @@ package tree
 
 import (
 	"fmt"
+	"io"
+	"slices"
+	"sync"
 
 	"github.com/yeahdongcn/topology/pkg/slurm"
 )
@@ -11,49 +14,510 @@ const (
 	DefaultConfigName = "topology.conf"
 	// DefaultConfigPath is the default configuration file path for the topology tree.
 	DefaultConfigPath = "/etc/slurm-llnl/" + DefaultConfigName
+
+	// PluginTree selects the hierarchical switch model of SwitchName lines.
+	PluginTree = "topology/tree"
+	// PluginBlock selects the block model of BlockName and BlockSizes lines.
+	PluginBlock = "topology/block"
+)
+
+// Topology is a switch hierarchy or a set of blocks loaded from a topology
+// configuration file. A Topology is never modified after it has been loaded,
+// so it is safe for concurrent use by multiple goroutines.
+type Topology struct {
+	plugin string /* PluginTree or PluginBlock */
+
+	switch_record_table []*switch_record_t
+	switch_record_cnt   int
+
+	block_record_table []*block_record_t
+	block_record_cnt   int
+	bblock_node_cnt    int   /* nodes per base block */
+	block_sizes        []int /* allowed aggregations, in base blocks */
+
+	node_record_table []*node_record_t
+	node_record_cnt   int
+	node_hash_table   map[string]int /* node name to node_record_table index */
+	node_order        map[string]int /* NodeName definition order, if known */
+
+	diagnostics []*ConfigError /* problems skipped while loading */
+
+	have_dragonfly bool /* TopologyParam=Dragonfly */
+}
+
+type load_options_t struct {
+	strict    bool
+	dragonfly bool
+	plugin    string
+	weights   map[string]uint32
+	order     []string
+
+	switch_as_node_rank bool
+}
+
+// LoadOption configures how a topology configuration is loaded.
+type LoadOption func(*load_options_t)
+
+// WithStrict makes loading fail with a *ValidationError if the configuration
+// has any problem, instead of skipping the offending settings as Slurm does.
+func WithStrict() LoadOption {
+	return func(o *load_options_t) {
+		o.strict = true
+	}
+}
+
+// WithDragonfly makes Eval optimize allocations for a dragonfly network,
+// as Slurm does with TopologyParam=Dragonfly. A job is placed on one leaf
+// switch if possible, otherwise its nodes are spread over leaf switches in
+// a round-robin fashion.
+func WithDragonfly() LoadOption {
+	return func(o *load_options_t) {
+		o.dragonfly = true
+	}
+}
+
+// WithPlugin selects the topology plugin, PluginTree or PluginBlock, that
+// interprets the configuration. By default, PluginBlock is used if the
+// configuration has BlockName lines and PluginTree otherwise.
+func WithPlugin(plugin string) LoadOption {
+	return func(o *load_options_t) {
+		o.plugin = plugin
+	}
+}
+
+// WithNodeWeights sets the scheduling weights of nodes, as Weight= does in
+// slurm.conf. Eval allocates nodes of the lowest weight first and only uses
+// nodes of a higher weight as needed. Nodes missing from weights keep the
+// default weight of 1, weights of nodes not in the topology are ignored.
+func WithNodeWeights(weights map[string]uint32) LoadOption {
+	return func(o *load_options_t) {
+		o.weights = weights
+	}
+}
+
+// WithNodeOrder orders the nodes as slurmctld does when slurm.conf defines
+// them in the given order, as LoadNodeOrder returns it. Nodes are selected
+// and listed in this order. Without it, nodes are in natural order of their
+// names, which differs from slurmctld when slurm.conf defines nodes in another
+// order. Nodes missing from order follow the others in natural order.
+func WithNodeOrder(order []string) LoadOption {
+	return func(o *load_options_t) {
+		o.order = order
+	}
+}
+
+// WithSwitchAsNodeRank orders the nodes of a tree topology by their rank,
+// as Slurm does with TopologyParam=SwitchAsNodeRank. Nodes are then selected
+// and listed leaf switch by leaf switch, in configuration order of the leaf
+// switches, instead of in the order of WithNodeOrder or natural order.
+func WithSwitchAsNodeRank() LoadOption {
+	return func(o *load_options_t) {
+		o.switch_as_node_rank = true
+	}
+}
+
+// Switch describes a switch of a loaded topology.
+type Switch struct {
+	// Name is the switch name.
+	Name string
+	// Level is the level in the hierarchy, leaf switches are at level 0.
+	Level int
+	// Parent is the name of the parent switch, empty for top-level switches.
+	Parent string
+	// Switches are the names of the direct descendant switches.
+	Switches []string
+	// Nodes are the names of all nodes descended from this switch.
+	Nodes []string
+	// LinkSpeed is the link speed in arbitrary units.
+	LinkSpeed uint32
+}
+
+// Block describes a base block of a block topology.
+type Block struct {
+	// Name is the block name.
+	Name string
+	// Nodes are the names of the nodes in the block.
+	Nodes []string
+}
+
+// Load loads and validates the switch or block records from the given
+// configuration file.
+func Load(filename string, opts ...LoadOption) (*Topology, error) {
+	t := &Topology{}
+	conf, err := t._read_topo_file(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t._load(conf, opts)
+}
+
+// LoadReader loads and validates the switch or block records of a
+// configuration read from r. The configuration is called name in errors, and
+// the paths it includes are relative to the directory of name.
+func LoadReader(r io.Reader, name string, opts ...LoadOption) (*Topology, error) {
+	t := &Topology{}
+	conf, err := t._parse_topo_conf(r, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t._load(conf, opts)
+}
+
+/* Validate the records of conf with the topology plugin */
+func (t *Topology) _load(conf *topology_conf_t, opts []LoadOption) (*Topology, error) {
+	o := load_options_t{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	t.have_dragonfly = o.dragonfly
+	if len(o.order) > 0 {
+		t.node_order = make(map[string]int, len(o.order))
+		for i, name := range o.order {
+			if _, ok := t.node_order[name]; !ok {
+				t.node_order[name] = i
+			}
+		}
+	}
+
+	var err error
+	t.plugin = o.plugin
+	if t.plugin == "" {
+		t.plugin = PluginTree
+		if len(conf.blocks) > 0 {
+			t.plugin = PluginBlock
+		}
+	}
+	switch t.plugin {
+	case PluginTree:
+		err = t.switch_record_validate(conf)
+	case PluginBlock:
+		err = t.block_record_validate(conf)
+	default:
+		err = fmt.Errorf("%w: %s", ErrUnknownPlugin, t.plugin)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t._set_node_weights(o.weights)
+	if t.topology_p_generate_node_ranking() && o.switch_as_node_rank {
+		t._sort_nodes_by_rank()
+	}
+	if o.strict && len(t.diagnostics) > 0 {
+		return nil, &ValidationError{Diagnostics: t.Diagnostics()}
+	}
+	return t, nil
+}
+
+/* Topology of the last successful SwitchRecordValidate, for EvalNodesTree */
+var (
+	validated_topology    *Topology
+	validated_topology_mu sync.Mutex
 )
 
 // SwitchRecordValidate validates the switch records from the given configuration file.
-func SwitchRecordValidate(filename string) error {
-	return switch_record_validate(filename)
+func SwitchRecordValidate(filename string, opts ...LoadOption) error {
+	t, err := Load(filename, opts...)
+	if err != nil {
+		return err
+	}
+	validated_topology_mu.Lock()
+	validated_topology = t
+	validated_topology_mu.Unlock()
+	return nil
 }
 
-// EvalNodesTree evaluates the nodes tree.
-// It returns the selected nodes, the number of leaf switches, and an error if any.
+// EvalNodesTree evaluates the nodes tree of the topology last validated by
+// SwitchRecordValidate. It returns the selected nodes, the number of leaf
+// switches, and an error if any. Without a validated topology, no node is
+// selected.
+//
+// Deprecated: Use Load and Topology.Eval, which do not share the topology
+// between callers.
 func EvalNodesTree(availableNodes []string, requiredNodes []string, requestedNodeCount uint32) ([]string, uint16, error) {
+	validated_topology_mu.Lock()
+	t := validated_topology
+	validated_topology_mu.Unlock()
+	if t == nil {
+		return nil, 0, nil
+	}
+
+	selection, err := t.Eval(availableNodes, requiredNodes, requestedNodeCount)
+	if err != nil {
+		return nil, 0, err
+	}
+	return selection.Nodes, uint16(selection.LeafSwitchCount()), nil
+}
+
+// Diagnostics returns the configuration problems that were skipped while
+// loading the topology.
+func (t *Topology) Diagnostics() []*ConfigError {
+	return slices.Clone(t.diagnostics)
+}
+
+// Plugin returns the topology plugin that interprets the configuration,
+// PluginTree or PluginBlock.
+func (t *Topology) Plugin() string {
+	return t.plugin
+}
+
+// Switches returns the switches of the topology in configuration order.
+func (t *Topology) Switches() []Switch {
+	switches := make([]Switch, 0, t.switch_record_cnt)
+	for i, switch_ptr := range t.switch_record_table {
+		sw := Switch{
+			Name:      switch_ptr.name,
+			Level:     switch_ptr.level,
+			Switches:  make([]string, 0, switch_ptr.num_switches),
+			Nodes:     make([]string, 0, bit_set_count(switch_ptr.node_bitmap)),
+			LinkSpeed: switch_ptr.link_speed,
+		}
+		if int(switch_ptr.parent) != i {
+			sw.Parent = t.switch_record_table[switch_ptr.parent].name
+		}
+		for _, child := range switch_ptr.switch_index {
+			sw.Switches = append(sw.Switches, t.switch_record_table[child].name)
+		}
+		sw.Nodes = append(sw.Nodes, t.bitmap2hostlist(switch_ptr.node_bitmap)...)
+		switches = append(switches, sw)
+	}
+	return switches
+}
+
+// Blocks returns the base blocks of a block topology in configuration order.
+func (t *Topology) Blocks() []Block {
+	blocks := make([]Block, 0, t.block_record_cnt)
+	for _, block_ptr := range t.block_record_table {
+		blocks = append(blocks, Block{
+			Name:  block_ptr.name,
+			Nodes: t.bitmap2hostlist(block_ptr.node_bitmap),
+		})
+	}
+	return blocks
+}
+
+// BlockSizes returns the node counts of the aligned block aggregations a job
+// can be placed in, in increasing order. The first is the base block size.
+func (t *Topology) BlockSizes() []int {
+	sizes := make([]int, 0, len(t.block_sizes))
+	for _, size := range t.block_sizes {
+		sizes = append(sizes, size*t.bblock_node_cnt)
+	}
+	return sizes
+}
+
+// Nodes returns the names of all nodes connected to the topology, in the
+// order they are selected in.
+func (t *Topology) Nodes() []string {
+	nodes := make([]string, 0, t.node_record_cnt)
+	for _, node_ptr := range t.node_record_table {
+		nodes = append(nodes, node_ptr.name)
+	}
+	return nodes
+}
+
+// GenerateNodeRanking returns the rank of each node of a tree topology. All
+// nodes of a leaf switch share a rank, leaf switches are ranked from 1 in
+// configuration order. It returns an empty map for a block topology.
+func (t *Topology) GenerateNodeRanking() map[string]int {
+	ranks := map[string]int{}
+	for _, node_ptr := range t.node_record_table {
+		if node_ptr.node_rank > 0 {
+			ranks[node_ptr.name] = node_ptr.node_rank
+		}
+	}
+	return ranks
+}
+
+// SwitchPath returns the switches from the leaf switch of node up to the top
+// of the tree, following the parent of each switch. A node connected to more
+// than one leaf switch follows the first one in configuration order. It
+// returns an empty path for a block topology.
+func (t *Topology) SwitchPath(node string) ([]string, error) {
+	node_inx := t._find_node_inx(node)
+	if node_inx < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNode, node)
+	}
+
+	path := []string{}
+	for i, switch_ptr := range t.switch_record_table {
+		if switch_ptr.level != 0 || !bit_test(switch_ptr.node_bitmap, node_inx) {
+			continue
+		}
+		for j := i; ; j = int(t.switch_record_table[j].parent) {
+			path = append(path, t.switch_record_table[j].name)
+			if int(t.switch_record_table[j].parent) == j {
+				break
+			}
+		}
+		break
+	}
+	return path, nil
+}
+
+/* Return the indexes of switch name, or of the leaf switches of node name */
+func (t *Topology) _distance_switches(name string) []int {
+	for i, switch_ptr := range t.switch_record_table {
+		if switch_ptr.name == name {
+			return []int{i}
+		}
+	}
+	switches := []int{}
+	if node_inx := t._find_node_inx(name); node_inx >= 0 {
+		for i, switch_ptr := range t.switch_record_table {
+			if switch_ptr.level == 0 && bit_test(switch_ptr.node_bitmap, node_inx) {
+				switches = append(switches, i)
+			}
+		}
+	}
+	return switches
+}
+
+// Distance returns the number of links between two switches or nodes of a
+// tree topology. A node is as far as the closest of its leaf switches, so the
+// nodes of a leaf switch are at distance 0 from each other.
+func (t *Topology) Distance(from, to string) (uint32, error) {
+	if t.switch_record_cnt == 0 {
+		return 0, ErrNoSwitches
+	}
+	from_switches := t._distance_switches(from)
+	if len(from_switches) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownName, from)
+	}
+	to_switches := t._distance_switches(to)
+	if len(to_switches) == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownName, to)
+	}
+
+	dist := uint32(INFINITE)
+	for _, i := range from_switches {
+		for _, j := range to_switches {
+			dist = min(dist, t.switch_record_table[i].switches_dist[j])
+		}
+	}
+	if dist == INFINITE {
+		return 0, fmt.Errorf("%w: %s and %s", ErrUnreachable, from, to)
+	}
+	return dist, nil
+}
+
+// SwitchNodes are the selected nodes connected to a leaf switch, or in a
+// block of a block topology.
+type SwitchNodes struct {
+	// Name is the name of the leaf switch or block.
+	Name string
+	// Nodes are the selected nodes of the leaf switch or block.
+	Nodes []string
+}
+
+// Selection is the result of Eval.
+type Selection struct {
+	// Nodes are the selected nodes, in the order they are selected in.
+	Nodes []string
+	// TopSwitch is the switch the allocation was built under, empty for a
+	// block topology.
+	TopSwitch string
+	// LeafSwitches are the leaf switches used, in configuration order, with
+	// the selected nodes connected to each. For a block topology, they are
+	// the blocks used. A node connected to several leaf switches is listed
+	// under each of them.
+	LeafSwitches []SwitchNodes
+	// SwitchesDist is, for each switch, the sum of its distances in links to
+	// the switches the allocation was built from. Unreachable switches are
+	// left out. It is nil if the request was satisfied without choosing
+	// leaf switches by distance, e.g. by the required nodes alone.
+	SwitchesDist map[string]uint32
+}
+
+// LeafSwitchCount returns the number of leaf switches, or of blocks for a
+// block topology, used by the selection.
+func (s *Selection) LeafSwitchCount() int {
+	return len(s.LeafSwitches)
+}
+
+// Eval evaluates the nodes tree, or the blocks of a block topology, and
+// selects requestedNodeCount nodes among availableNodes, including all of
+// requiredNodes. Available nodes not in the topology are ignored.
+func (t *Topology) Eval(availableNodes []string, requiredNodes []string, requestedNodeCount uint32, opts ...EvalOption) (*Selection, error) {
+	o := eval_options_t{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.trace != nil {
+		*o.trace = Trace{}
+	}
 
 	availableNodesInNodeRecordTable := []string{}
 	for _, availableNode := range availableNodes {
-		if nodeInNodeRecordTable(availableNode, node_record_table) {
+		if t._find_node_inx(availableNode) >= 0 {
 			availableNodesInNodeRecordTable = append(availableNodesInNodeRecordTable, availableNode)
 		}
 	}
 
 	if len(availableNodesInNodeRecordTable) == 0 {
-		return nil, 0, nil
+		if o.trace != nil {
+			o.trace.StopReason = "no available node in the topology"
+		}
+		return &Selection{Nodes: []string{}}, nil
 	}
 
-	var (
-		node_map        *bitstr_t
-		req_node_bitmap *bitstr_t
-	)
-	if len(availableNodesInNodeRecordTable)+len(requiredNodes) > 0 {
-		b1 := bitstr_t(availableNodesInNodeRecordTable)
-		b2 := bitstr_t(requiredNodes)
-		bit_or(&b1, &b2)
-		node_map = &b1
+	node_map, err := t._node_list2bitmap(availableNodesInNodeRecordTable)
+	if err != nil {
+		return nil, err
 	}
+	var req_node_bitmap *bitstr_t
 	if len(requiredNodes) > 0 {
-		bitmap := bitstr_t(requiredNodes)
-		req_node_bitmap = &bitmap
+		req_node_bitmap, err = t._node_list2bitmap(requiredNodes)
+		if err != nil {
+			return nil, err
+		}
+		bit_or(node_map, req_node_bitmap)
 	}
 	eval := topology_eval_t{
 		node_map:        node_map,
 		req_node_bitmap: req_node_bitmap,
 		req_nodes:       requestedNodeCount,
+		trace:           o.trace,
+	}
+	if t.topology_g_eval_nodes(&eval) == slurm.ERROR {
+		return nil, ErrEvalFailed
 	}
-	if eval_nodes_tree(&eval, false) == slurm.ERROR {
-		return nil, 0, fmt.Errorf("failed to evaluate nodes tree")
+	return t._eval_selection(&eval), nil
+}
+
+/* Build the Selection of a successful evaluation */
+func (t *Topology) _eval_selection(topo_eval *topology_eval_t) *Selection {
+	selection := &Selection{
+		Nodes:        t.bitmap2hostlist(topo_eval.node_map),
+		LeafSwitches: make([]SwitchNodes, 0, len(topo_eval.leaf_switches)),
+	}
+
+	for _, inx := range topo_eval.leaf_switches {
+		var name string
+		var node_bitmap *bitstr_t
+		if t.plugin == PluginBlock {
+			name = t.block_record_table[inx].name
+			node_bitmap = bit_copy(t.block_record_table[inx].node_bitmap)
+		} else {
+			name = t.switch_record_table[inx].name
+			node_bitmap = bit_copy(t.switch_record_table[inx].node_bitmap)
+		}
+		bit_and(node_bitmap, topo_eval.node_map)
+		selection.LeafSwitches = append(selection.LeafSwitches, SwitchNodes{
+			Name:  name,
+			Nodes: t.bitmap2hostlist(node_bitmap),
+		})
+	}
+
+	if topo_eval.top_switch_inx >= 0 {
+		selection.TopSwitch = t.switch_record_table[topo_eval.top_switch_inx].name
+	}
+	if topo_eval.switches_dist != nil {
+		selection.SwitchesDist = map[string]uint32{}
+		for i, dist := range topo_eval.switches_dist {
+			if dist != INFINITE {
+				selection.SwitchesDist[t.switch_record_table[i].name] = dist
+			}
+		}
 	}
-	return *eval.node_map, eval.leaf_switch_cnt, nil
+	return selection
 }
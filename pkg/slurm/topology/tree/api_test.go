@@ -0,0 +1,258 @@
+package tree
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+func TestLoad(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"tu-x0", "tu-x1", "tu-x2", "tu-x3", "tux4", "tux5", "tux6", "tux7"}, topo.Nodes())
+
+	switches := topo.Switches()
+	require.Len(t, switches, 7)
+	require.Equal(t, Switch{
+		Name:     "s5",
+		Level:    1,
+		Parent:   "s6",
+		Switches: []string{"s2", "s3"},
+		Nodes:    []string{"tux4", "tux5", "tux6", "tux7"},
+	}, switches[5])
+	require.Equal(t, "", switches[6].Parent)
+	require.Equal(t, 2, switches[6].Level)
+	require.Equal(t, []string{"tu-x0", "tu-x1", "tu-x2", "tu-x3"}, switches[4].Nodes)
+
+	/* Nodes are ordered naturally, not as they appear in the file */
+	topo, err = Load("../../../../test/topology3.conf")
+	require.NoError(t, err)
+	nodes := topo.Nodes()
+	require.Equal(t, "worker001", nodes[0])
+	require.Equal(t, "worker202", nodes[len(nodes)-1])
+	require.True(t, slices.IsSortedFunc(nodes, hostlist.Compare))
+}
+
+func TestLoadReader(t *testing.T) {
+	topo, err := LoadReader(strings.NewReader("SwitchName=s0 Nodes=tux[0-1]\nSwitchName=s1 Switches=s0\n"), "inline.conf")
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux0", "tux1"}, topo.Nodes())
+	require.Equal(t, "s0", topo.Switches()[1].Switches[0])
+
+	_, err = LoadReader(strings.NewReader("SwitchName=s0 Nodes=tux[0-\n"), "inline.conf")
+	var configErr *ConfigError
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, "inline.conf", configErr.File)
+}
+
+func TestTopology_Eval(t *testing.T) {
+	topo1, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+	topo2, err := Load("../../../../test/topology2.conf")
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			selection, err := topo1.Eval([]string{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}, nil, 3)
+			require.NoError(t, err)
+			require.Equal(t, []string{"tux5", "tux6", "tux7"}, selection.Nodes)
+			require.Equal(t, 2, selection.LeafSwitchCount())
+		}()
+		go func() {
+			defer wg.Done()
+			selection, err := topo2.Eval([]string{"tux0", "tux1", "tux2", "tux12", "tux13", "tux14", "tux15"}, nil, 4)
+			require.NoError(t, err)
+			require.Equal(t, []string{"tux12", "tux13", "tux14", "tux15"}, selection.Nodes)
+			require.Equal(t, 1, selection.LeafSwitchCount())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestEvalNodesTree(t *testing.T) {
+	require.NoError(t, SwitchRecordValidate("../../../../test/topology1.conf"))
+	nodes, leafSwitchCount, err := EvalNodesTree([]string{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}, nil, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux5", "tux6", "tux7"}, nodes)
+	require.Equal(t, uint16(2), leafSwitchCount)
+
+	/* A failed validation keeps the topology validated last */
+	require.Error(t, SwitchRecordValidate("../../../../test/missing.conf"))
+	nodes, _, err = EvalNodesTree([]string{"tu-x0", "tu-x1"}, nil, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tu-x0", "tu-x1"}, nodes)
+}
+
+func TestTopology_Eval_dragonfly(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf", WithDragonfly())
+	require.NoError(t, err)
+
+	selection, err := topo.Eval([]string{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}, nil, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tu-x1", "tux6", "tux7"}, selection.Nodes)
+	require.Equal(t, []SwitchNodes{{"s0", []string{"tu-x1"}}, {"s3", []string{"tux6", "tux7"}}}, selection.LeafSwitches)
+}
+
+func TestTopology_Eval_block(t *testing.T) {
+	topo, err := Load("../../../../test/block1.conf")
+	require.NoError(t, err)
+
+	selection, err := topo.Eval(topo.Nodes(), nil, 20)
+	require.NoError(t, err)
+	require.Len(t, selection.Nodes, 20)
+	require.Equal(t, "gb200-001", selection.Nodes[0])
+	require.Equal(t, "gb200-020", selection.Nodes[19])
+	require.Equal(t, 2, selection.LeafSwitchCount())
+	require.Equal(t, "b2", selection.LeafSwitches[1].Name)
+	require.Equal(t, []string{"gb200-019", "gb200-020"}, selection.LeafSwitches[1].Nodes)
+	require.Empty(t, selection.TopSwitch)
+	require.Nil(t, selection.SwitchesDist)
+}
+
+func TestTopology_Eval_weights(t *testing.T) {
+	topo, err := Load("../../../../test/topology2.conf", WithNodeWeights(map[string]uint32{
+		"tux12": 100, "tux13": 100, "tux14": 100, "tux15": 100,
+	}))
+	require.NoError(t, err)
+
+	selection, err := topo.Eval([]string{"tux0", "tux1", "tux2", "tux12", "tux13", "tux14", "tux15"}, nil, 4)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux0", "tux1", "tux2", "tux12"}, selection.Nodes)
+}
+
+func TestTopology_Eval_errors(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	_, err = topo.Eval(topo.Nodes(), []string{"tux9"}, 2)
+	require.ErrorIs(t, err, ErrUnknownNode)
+	require.EqualError(t, err, "node not found in topology: tux9")
+
+	_, err = topo.Eval(topo.Nodes(), nil, 9)
+	require.ErrorIs(t, err, ErrEvalFailed)
+}
+
+func TestTopology_Eval_selection(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	selection, err := topo.Eval([]string{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}, nil, 3)
+	require.NoError(t, err)
+	require.Equal(t, &Selection{
+		Nodes:     []string{"tux5", "tux6", "tux7"},
+		TopSwitch: "s6",
+		LeafSwitches: []SwitchNodes{
+			{Name: "s2", Nodes: []string{"tux5"}},
+			{Name: "s3", Nodes: []string{"tux6", "tux7"}},
+		},
+		SwitchesDist: map[string]uint32{
+			"s0": 8, "s1": 8, "s2": 2, "s3": 2, "s4": 6, "s5": 2, "s6": 4,
+		},
+	}, selection)
+
+	/* Required nodes satisfy the request */
+	selection, err = topo.Eval([]string{"tu-x0", "tux4"}, []string{"tu-x0", "tux4"}, 2)
+	require.NoError(t, err)
+	require.Equal(t, "s6", selection.TopSwitch)
+	require.Equal(t, 2, selection.LeafSwitchCount())
+	require.Nil(t, selection.SwitchesDist)
+}
+
+func TestTopology_Eval_trace(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	var trace Trace
+	_, err = topo.Eval([]string{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}, nil, 3, WithTrace(&trace))
+	require.NoError(t, err)
+	require.Equal(t, "s6", trace.TopSwitch)
+	require.Equal(t, "highest level switch with 3 or more available nodes of the lowest weight 1", trace.TopSwitchReason)
+	require.Len(t, trace.Steps, 2)
+	require.Equal(t, TraceStep{
+		RemainingNodes: 3,
+		Candidates: []TraceCandidate{
+			{Switch: "s0", NodeCount: 1, Preferred: true},
+			{Switch: "s1", NodeCount: 1, Best: "s0", Fit: 0},
+			{Switch: "s2", NodeCount: 1, Best: "s0", Fit: 1, Preferred: true},
+			{Switch: "s3", NodeCount: 2, Best: "s2", Fit: 1, Preferred: true},
+		},
+		Chosen: "s3",
+	}, trace.Steps[0])
+	/* Closer to s3 wins over an equal fit */
+	require.Equal(t, TraceCandidate{Switch: "s2", Distance: 2, NodeCount: 1, Best: "s0", Fit: 0, Preferred: true},
+		trace.Steps[1].Candidates[2])
+	require.Equal(t, "s2", trace.Steps[1].Chosen)
+	require.Equal(t, "request satisfied from leaf switch s2", trace.StopReason)
+
+	/* The trace is reset and recorded on failure */
+	_, err = topo.Eval(topo.Nodes(), nil, 9, WithTrace(&trace))
+	require.ErrorIs(t, err, ErrEvalFailed)
+	require.Equal(t, Trace{StopReason: "unable to identify top level switch"}, trace)
+
+	_, err = topo.Eval(topo.Nodes(), []string{"tu-x0", "tux4"}, 3, WithTrace(&trace))
+	require.NoError(t, err)
+	require.Equal(t, "highest level switch with required nodes", trace.TopSwitchReason)
+	require.Equal(t, "request satisfied from required leaf switch s0", trace.StopReason)
+}
+
+func TestTopology_Distance(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		from, to string
+		dist     uint32
+	}{
+		{"s0", "s0", 0},
+		{"s0", "s4", 1},
+		{"s0", "s3", 4},
+		{"s6", "s2", 2},
+		{"tux6", "tux7", 0},
+		{"tux5", "tux6", 2},
+		{"tu-x0", "s5", 3},
+	} {
+		dist, err := topo.Distance(tc.from, tc.to)
+		require.NoError(t, err)
+		require.Equal(t, tc.dist, dist, "%s to %s", tc.from, tc.to)
+	}
+
+	_, err = topo.Distance("s0", "tux9")
+	require.ErrorIs(t, err, ErrUnknownName)
+
+	topo, err = Load(_write_topo_file(t, "SwitchName=s0 Nodes=tux0\nSwitchName=s1 Nodes=tux1\n"))
+	require.NoError(t, err)
+	_, err = topo.Distance("tux0", "tux1")
+	require.ErrorIs(t, err, ErrUnreachable)
+
+	topo, err = Load("../../../../test/block1.conf")
+	require.NoError(t, err)
+	_, err = topo.Distance("gb200-001", "gb200-019")
+	require.ErrorIs(t, err, ErrNoSwitches)
+}
+
+func TestTopology_SwitchPath(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	path, err := topo.SwitchPath("tux5")
+	require.NoError(t, err)
+	require.Equal(t, []string{"s2", "s5", "s6"}, path)
+
+	_, err = topo.SwitchPath("tux9")
+	require.ErrorIs(t, err, ErrUnknownNode)
+
+	topo, err = Load("../../../../test/block1.conf")
+	require.NoError(t, err)
+	path, err = topo.SwitchPath("gb200-001")
+	require.NoError(t, err)
+	require.Empty(t, path)
+}
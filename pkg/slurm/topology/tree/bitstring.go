@@ -1,20 +1,40 @@
 package tree
 
 import (
-	"slices"
-	"sort"
-	"strconv"
-	"strings"
-	"unicode"
-
-	log "github.com/sirupsen/logrus"
+	"math/bits"
 )
 
-type bitstr_t []string
+/*
+ * bitstr_t is a fixed size bitmap. Bits are node indexes into the
+ * node_record_table of the topology that allocated the bitmap.
+ */
+type bitstr_t struct {
+	words []uint64
+	nbits int
+}
+
+const bits_per_word = 64
+
+func bit_alloc(nbits int) *bitstr_t {
+	return &bitstr_t{
+		words: make([]uint64, (nbits+bits_per_word-1)/bits_per_word),
+		nbits: nbits,
+	}
+}
+
+func bit_size(b *bitstr_t) int {
+	return b.nbits
+}
 
 func bit_super_set(b1, b2 *bitstr_t) bool {
-	for _, bit := range *b1 {
-		if !bit_test(b2, bit) {
+	for i, w := range b1.words {
+		if i >= len(b2.words) {
+			if w != 0 {
+				return false
+			}
+			continue
+		}
+		if w&^b2.words[i] != 0 {
 			return false
 		}
 	}
@@ -22,76 +42,93 @@ func bit_super_set(b1, b2 *bitstr_t) bool {
 }
 
 func bit_overlap_any(b1, b2 *bitstr_t) bool {
-	for _, bit := range *b1 {
-		if bit_test(b2, bit) {
+	n := min(len(b1.words), len(b2.words))
+	for i := 0; i < n; i++ {
+		if b1.words[i]&b2.words[i] != 0 {
 			return true
 		}
 	}
 	return false
 }
 
-func bit_set(b *bitstr_t, bit string) bool {
-	increased := false
-	if !bit_test(b, bit) {
-		*b = append(*b, bit)
-		increased = true
+/* Set bit, returning true if it was not already set */
+func bit_set(b *bitstr_t, bit int) bool {
+	mask := uint64(1) << (bit % bits_per_word)
+	w := &b.words[bit/bits_per_word]
+	if *w&mask != 0 {
+		return false
 	}
-	sort.Slice(*b, func(i, j int) bool {
-		numI, _ := strconv.Atoi(strings.TrimLeftFunc((*b)[i], unicode.IsLetter))
-		numJ, _ := strconv.Atoi(strings.TrimLeftFunc((*b)[j], unicode.IsLetter))
-		return numI < numJ
-	})
-	return increased
+	*w |= mask
+	return true
 }
 
-func bit_test(b *bitstr_t, bit string) bool {
-	return slices.Contains(*b, bit)
+func bit_clear(b *bitstr_t, bit int) {
+	b.words[bit/bits_per_word] &^= uint64(1) << (bit % bits_per_word)
 }
 
-func bit_or(b1, b2 *bitstr_t) {
-	set := make(map[string]struct{})
-	for _, v := range *b1 {
-		set[v] = struct{}{}
-	}
-	for _, v := range *b2 {
-		set[v] = struct{}{}
+func bit_test(b *bitstr_t, bit int) bool {
+	if bit < 0 || bit >= b.nbits {
+		return false
 	}
+	return b.words[bit/bits_per_word]&(uint64(1)<<(bit%bits_per_word)) != 0
+}
 
-	new := make([]string, 0, len(set))
-	for k := range set {
-		new = append(new, k)
+func bit_or(b1, b2 *bitstr_t) {
+	n := min(len(b1.words), len(b2.words))
+	for i := 0; i < n; i++ {
+		b1.words[i] |= b2.words[i]
 	}
-
-	sort.Slice(new, func(i, j int) bool {
-		numI, _ := strconv.Atoi(strings.TrimLeftFunc(new[i], unicode.IsLetter))
-		numJ, _ := strconv.Atoi(strings.TrimLeftFunc(new[j], unicode.IsLetter))
-		return numI < numJ
-	})
-	*b1 = new
 }
 
 func bit_and(b1, b2 *bitstr_t) {
-	var new bitstr_t
-	for _, bit := range *b1 {
-		if bit_test(b2, bit) {
-			new = append(new, bit)
+	for i := range b1.words {
+		if i < len(b2.words) {
+			b1.words[i] &= b2.words[i]
 		} else {
-			log.Tracef("Removing %s from hostlist", bit)
+			b1.words[i] = 0
 		}
 	}
-	*b1 = new
 }
 
 func bit_copy(b *bitstr_t) *bitstr_t {
-	new := make(bitstr_t, len(*b))
-	copy(new, *b)
-	return &new
+	new := &bitstr_t{
+		words: make([]uint64, len(b.words)),
+		nbits: b.nbits,
+	}
+	copy(new.words, b.words)
+	return new
 }
 
 func bit_set_count(b *bitstr_t) int {
-	return len(*b)
+	cnt := 0
+	for _, w := range b.words {
+		cnt += bits.OnesCount64(w)
+	}
+	return cnt
 }
 
 func bit_clear_all(b *bitstr_t) {
-	*b = (*b)[:0]
+	clear(b.words)
+}
+
+/* Return the index of the first set bit at or after bit n, or -1 if none */
+func bit_ffs_from_bit(b *bitstr_t, n int) int {
+	if n < 0 {
+		n = 0
+	}
+	for i := n / bits_per_word; i < len(b.words); i++ {
+		w := b.words[i]
+		if i == n/bits_per_word {
+			w &= ^uint64(0) << (n % bits_per_word)
+		}
+		if w != 0 {
+			return i*bits_per_word + bits.TrailingZeros64(w)
+		}
+	}
+	return -1
+}
+
+/* Return the index of the first set bit, or -1 if none */
+func bit_ffs(b *bitstr_t) int {
+	return bit_ffs_from_bit(b, 0)
 }
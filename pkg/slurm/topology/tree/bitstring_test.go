@@ -6,40 +6,61 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func TestHostlist(t *testing.T) {
-	b1 := bitstr_t{"a1", "a2", "a10"}
-	b2 := bitstr_t{"a2", "a3", "a11"}
+func bitmap_of(nbits int, bits ...int) *bitstr_t {
+	b := bit_alloc(nbits)
+	for _, bit := range bits {
+		bit_set(b, bit)
+	}
+	return b
+}
 
-	bit_and(&b1, &b2)
-	require.Equal(t, 1, bit_set_count(&b1))
-	require.Equal(t, bitstr_t{"a2"}, b1)
+func TestBitstring(t *testing.T) {
+	b1 := bitmap_of(130, 1, 2, 10, 128)
+	b2 := bitmap_of(130, 2, 3, 11, 128)
 
-	b1 = bitstr_t{"a1", "a2", "a10"}
-	b2 = bitstr_t{"a2", "a3", "a11"}
+	bit_and(b1, b2)
+	require.Equal(t, 2, bit_set_count(b1))
+	require.Equal(t, bitmap_of(130, 2, 128), b1)
 
-	bit_or(&b1, &b2)
-	require.Equal(t, 5, bit_set_count(&b1))
-	require.Equal(t, bitstr_t{"a1", "a2", "a3", "a10", "a11"}, b1)
+	b1 = bitmap_of(130, 1, 2, 10)
+	bit_or(b1, b2)
+	require.Equal(t, 6, bit_set_count(b1))
+	require.Equal(t, bitmap_of(130, 1, 2, 3, 10, 11, 128), b1)
 
-	b1 = bitstr_t{}
-	b2 = bitstr_t{"b", "c", "d"}
-	b1 = *bit_copy(&b2)
-	require.Equal(t, false, &b1 == &b2)
+	b1 = bit_copy(b2)
+	require.Equal(t, false, b1 == b2)
+	require.Equal(t, b2, b1)
+	bit_set(b1, 4)
+	require.Equal(t, false, bit_test(b2, 4))
 
-	require.Equal(t, true, bit_test(&b1, "b"))
-	require.Equal(t, false, bit_test(&b1, "a"))
+	require.Equal(t, true, bit_test(b1, 128))
+	require.Equal(t, false, bit_test(b1, 129))
+	require.Equal(t, false, bit_test(b1, -1))
+	require.Equal(t, false, bit_test(b1, 130))
 
-	b1 = bitstr_t{"a1", "a2", "a10"}
-	increased := bit_set(&b1, "a3")
+	b1 = bitmap_of(130, 1, 2, 10)
+	increased := bit_set(b1, 3)
 	require.Equal(t, true, increased)
-	require.Equal(t, 4, bit_set_count(&b1))
-	require.Equal(t, bitstr_t{"a1", "a2", "a3", "a10"}, b1)
+	increased = bit_set(b1, 3)
+	require.Equal(t, false, increased)
+	require.Equal(t, 4, bit_set_count(b1))
+	bit_clear(b1, 3)
+	require.Equal(t, false, bit_test(b1, 3))
+
+	require.Equal(t, true, bit_overlap_any(b1, bitmap_of(130, 10)))
+	require.Equal(t, false, bit_overlap_any(b1, bitmap_of(130, 11)))
+
+	require.Equal(t, true, bit_super_set(bitmap_of(130, 1, 10), b1))
+	require.Equal(t, false, bit_super_set(bitmap_of(130, 1, 11), b1))
+	require.Equal(t, true, bit_super_set(bit_alloc(130), b1))
 
-	b2 = bitstr_t{"a3"}
-	require.Equal(t, len(b1), bit_set_count(&b1))
-	require.Equal(t, true, bit_overlap_any(&b1, &b2))
+	require.Equal(t, 130, bit_size(b1))
+	require.Equal(t, 1, bit_ffs(b1))
+	require.Equal(t, 10, bit_ffs_from_bit(b1, 3))
+	require.Equal(t, 128, bit_ffs_from_bit(b2, 12))
+	require.Equal(t, -1, bit_ffs_from_bit(b2, 129))
 
-	b1 = bitstr_t{"a1", "a2", "a10"}
-	bit_clear_all(&b1)
-	require.Equal(t, 0, bit_set_count(&b1))
+	bit_clear_all(b1)
+	require.Equal(t, 0, bit_set_count(b1))
+	require.Equal(t, -1, bit_ffs(b1))
 }
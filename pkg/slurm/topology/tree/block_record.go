@@ -0,0 +1,184 @@
+package tree
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+type slurm_conf_block_t struct {
+	block_name string /* name of this block */
+	nodes      string /* names of nodes in this block */
+	file       string /* configuration file defining this block */
+	line       int    /* line number in file */
+}
+
+type slurm_conf_block_sizes_t struct {
+	block_sizes string /* planning base block aggregation sizes, in nodes */
+	file        string /* configuration file defining the sizes */
+	line        int    /* line number in file */
+}
+
+type block_record_t struct {
+	name        string    /* block name */
+	node_bitmap *bitstr_t /* bitmap of all nodes in this block */
+	nodes       string    /* name of nodes in this block */
+	file        string    /* configuration file defining this block */
+	line        int       /* line number in file */
+}
+
+/* Parse a "BlockName=... Nodes=..." line, nil if it is skipped */
+func (t *Topology) _parse_block(pairs []key_value_t, filename string, line int) *slurm_conf_block_t {
+	block := &slurm_conf_block_t{
+		block_name: pairs[0].value,
+		file:       filename,
+		line:       line,
+	}
+	for _, pair := range pairs[1:] {
+		switch strings.ToLower(pair.key) {
+		case "nodes":
+			block.nodes = pair.value
+		default:
+			t._diag(&ConfigError{File: filename, Line: line, Block: block.block_name,
+				Err: fmt.Errorf("%w: %s", ErrUnknownKey, pair.key)})
+		}
+	}
+
+	if len(block.nodes) == 0 {
+		t._diag(&ConfigError{File: filename, Line: line, Block: block.block_name,
+			Err: ErrNoBlockNodes})
+		return nil
+	}
+	return block
+}
+
+/* Parse a "BlockSizes=..." line */
+func (t *Topology) _parse_block_sizes(pairs []key_value_t, filename string, line int) *slurm_conf_block_sizes_t {
+	for _, pair := range pairs[1:] {
+		t._diag(&ConfigError{File: filename, Line: line,
+			Err: fmt.Errorf("%w: %s", ErrUnknownKey, pair.key)})
+	}
+	return &slurm_conf_block_sizes_t{
+		block_sizes: pairs[0].value,
+		file:        filename,
+		line:        line,
+	}
+}
+
+/* Return a ConfigError locating the definition of block_ptr */
+func _block_error(block_ptr *block_record_t, err error) *ConfigError {
+	return &ConfigError{
+		File:  block_ptr.file,
+		Line:  block_ptr.line,
+		Block: block_ptr.name,
+		Err:   err,
+	}
+}
+
+/*
+ * _parse_block_size_list returns the configured aggregation sizes in base
+ * blocks. Each size must be a power of two multiple of the base block size
+ * and no larger than the number of blocks.
+ */
+func (t *Topology) _parse_block_size_list(ptr *slurm_conf_block_sizes_t) []int {
+	block_sizes := []int{}
+	for _, tok := range strings.Split(ptr.block_sizes, ",") {
+		node_cnt, err := strconv.Atoi(strings.TrimSpace(tok))
+		if err != nil || node_cnt <= 0 || node_cnt%t.bblock_node_cnt != 0 ||
+			bits.OnesCount(uint(node_cnt/t.bblock_node_cnt)) != 1 ||
+			node_cnt/t.bblock_node_cnt > t.block_record_cnt {
+			t._diag(&ConfigError{File: ptr.file, Line: ptr.line,
+				Err: fmt.Errorf("%w: %s", ErrInvalidBlockSize, tok)})
+			continue
+		}
+		block_sizes = append(block_sizes, node_cnt/t.bblock_node_cnt)
+	}
+	slices.Sort(block_sizes)
+	return slices.Compact(block_sizes)
+}
+
+func (t *Topology) block_record_validate(conf *topology_conf_t) error {
+	ptr_array := conf.blocks
+	if len(ptr_array) == 0 {
+		return &ConfigError{File: conf.file, Err: ErrNoBlocks}
+	}
+
+	/* Switch records are only understood by topology/tree */
+	for _, ptr := range conf.switches {
+		t._diag(&ConfigError{File: ptr.file, Line: ptr.line, Switch: ptr.switch_name,
+			Err: fmt.Errorf("%w: SwitchName", ErrUnknownKey)})
+	}
+
+	block_record_lookup_table := map[string]int{}
+	t.node_hash_table = map[string]int{}
+
+	for _, ptr := range ptr_array {
+		block_ptr := &block_record_t{
+			name:  ptr.block_name,
+			nodes: strings.Clone(ptr.nodes),
+			file:  ptr.file,
+			line:  ptr.line,
+		}
+
+		/* See if block name has already been defined. */
+		if _, ok := block_record_lookup_table[ptr.block_name]; ok {
+			t._diag(_block_error(block_ptr, ErrDuplicateBlock))
+			continue
+		}
+
+		names, err := hostlist.Expand(ptr.nodes)
+		if err != nil {
+			return _block_error(block_ptr, fmt.Errorf("invalid node name: %w", err))
+		}
+		/* Blocks are aggregated by index, so they can not share nodes */
+		if i := slices.IndexFunc(names, func(name string) bool {
+			return t._find_node_inx(name) >= 0
+		}); i >= 0 {
+			t._diag(_block_error(block_ptr, fmt.Errorf("%w: %s", ErrOverlappingBlocks, names[i])))
+			continue
+		}
+		for _, name := range names {
+			t._add_node_record(name)
+		}
+
+		block_record_lookup_table[ptr.block_name] = len(t.block_record_table)
+		t.block_record_table = append(t.block_record_table, block_ptr)
+	}
+	t.block_record_cnt = len(t.block_record_table)
+
+	t._sort_node_record_table()
+
+	/* The base block size is that of the largest block */
+	for _, block_ptr := range t.block_record_table {
+		block_ptr.node_bitmap, _ = t._node_name2bitmap(block_ptr.nodes)
+		t.bblock_node_cnt = max(t.bblock_node_cnt, bit_set_count(block_ptr.node_bitmap))
+	}
+	/* Slurm requires all blocks to be of the base block size */
+	for _, block_ptr := range t.block_record_table {
+		if node_cnt := bit_set_count(block_ptr.node_bitmap); node_cnt != t.bblock_node_cnt {
+			t._diag(_block_error(block_ptr, fmt.Errorf("%w: %d nodes, expected %d",
+				ErrUnequalBlocks, node_cnt, t.bblock_node_cnt)))
+		}
+	}
+
+	if conf.block_sizes != nil {
+		t.block_sizes = t._parse_block_size_list(conf.block_sizes)
+	}
+	if len(t.block_sizes) == 0 {
+		/* By default, all power of two aggregations of base blocks */
+		for size := 1; size <= t.block_record_cnt; size *= 2 {
+			t.block_sizes = append(t.block_sizes, size)
+		}
+	}
+
+	log.Debugf("Base block node count: %d, block sizes: %v",
+		t.bblock_node_cnt, t.block_sizes)
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_block_record_validate(t *testing.T) {
+	topo, err := Load("../../../../test/block1.conf")
+	require.NoError(t, err)
+	require.Equal(t, PluginBlock, topo.Plugin())
+	require.Equal(t, 4, topo.block_record_cnt)
+	require.Equal(t, 72, topo.node_record_cnt)
+	require.Equal(t, 18, topo.bblock_node_cnt)
+	require.Equal(t, []int{1, 2, 4}, topo.block_sizes)
+	require.Equal(t, []int{18, 36, 72}, topo.BlockSizes())
+	require.Empty(t, topo.Switches())
+	require.Empty(t, topo.Diagnostics())
+
+	blocks := topo.Blocks()
+	require.Len(t, blocks, 4)
+	require.Equal(t, "b2", blocks[1].Name)
+	require.Equal(t, "gb200-019", blocks[1].Nodes[0])
+	require.Len(t, blocks[1].Nodes, 18)
+
+	/* The tree plugin does not understand blocks */
+	_, err = Load("../../../../test/block1.conf", WithPlugin(PluginTree))
+	require.ErrorIs(t, err, ErrNoSwitches)
+	_, err = Load("../../../../test/block1.conf", WithPlugin("topology/torus"))
+	require.ErrorIs(t, err, ErrUnknownPlugin)
+	_, err = Load("../../../../test/topology1.conf", WithPlugin(PluginBlock))
+	require.ErrorIs(t, err, ErrNoBlocks)
+}
+
+func Test_block_record_validate_diagnostics(t *testing.T) {
+	filename := _write_topo_file(t, `BlockName=b1 Nodes=tux[0-3]
+BlockName=b2 Nodes=tux[4-7] Color=blue
+BlockName=b1 Nodes=tux[8-11]
+BlockName=b3 Nodes=tux[7-10]
+BlockName=b4
+BlockName=b5 Nodes=tux[12-13]
+SwitchName=s0 Nodes=tux[0-7]
+BlockSizes=4,6,12,8,16
+`)
+	topo, err := Load(filename)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b1", "b2", "b5"}, []string{
+		topo.block_record_table[0].name, topo.block_record_table[1].name, topo.block_record_table[2].name})
+	require.Equal(t, 10, topo.node_record_cnt)
+	/* The base block is the largest one, smaller blocks are reported */
+	require.Equal(t, 4, topo.bblock_node_cnt)
+	require.Equal(t, []int{4, 8}, topo.BlockSizes())
+
+	diags := []string{}
+	for _, diag := range topo.Diagnostics() {
+		diags = append(diags, diag.Error())
+	}
+	require.Equal(t, []string{
+		filename + ":2: block b2: unrecognized key: Color",
+		filename + ":5: block b4: block has no nodes",
+		filename + ":7: switch s0: unrecognized key: SwitchName",
+		filename + ":3: block b1: block has already been defined",
+		filename + ":4: block b3: node is already in another block: tux7",
+		filename + ":6: block b5: block size differs from the base block size: 2 nodes, expected 4",
+		filename + ":8: invalid BlockSizes: 6",
+		filename + ":8: invalid BlockSizes: 12",
+		filename + ":8: invalid BlockSizes: 16",
+	}, diags)
+
+	_, err = Load(filename, WithStrict())
+	require.ErrorIs(t, err, ErrOverlappingBlocks)
+	require.ErrorIs(t, err, ErrUnequalBlocks)
+
+	/* By default, all power of two aggregations of base blocks */
+	topo, err = Load(_write_topo_file(t, "BlockName=b[1-3] Nodes=tux[0-3]\nBlockName=b2 Nodes=tux[4-7]\nBlockName=b3 Nodes=tux[8-11]\n"))
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 8}, topo.BlockSizes())
+}
@@ -0,0 +1,126 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+var (
+	// ErrNoSwitches is returned when a configuration defines no switches.
+	ErrNoSwitches = errors.New("no switches configured")
+	// ErrSyntax is returned when a line of a configuration can not be parsed.
+	ErrSyntax = errors.New("syntax error")
+	// ErrInvalidHostlist is returned when a Nodes= or Switches= value is not
+	// a valid hostlist expression.
+	ErrInvalidHostlist = hostlist.ErrInvalid
+	// ErrNoChildren is reported when a switch has neither child switches nor nodes.
+	ErrNoChildren = errors.New("switch has neither child switches nor nodes")
+	// ErrUnknownChild is returned when a switch names a child switch that is
+	// not defined.
+	ErrUnknownChild = errors.New("invalid child switch")
+	// ErrCycle is returned when the switches do not form a tree.
+	ErrCycle = errors.New("switch configuration is not a tree")
+
+	// ErrUnknownKey is reported when a line has a key that is not recognized.
+	ErrUnknownKey = errors.New("unrecognized key")
+	// ErrInvalidLinkSpeed is reported when a LinkSpeed= value is not a number.
+	ErrInvalidLinkSpeed = errors.New("invalid LinkSpeed")
+	// ErrMixedChildren is reported when a switch has both child switches and nodes.
+	ErrMixedChildren = errors.New("switch has both child switches and nodes")
+	// ErrDuplicateSwitch is reported when a switch name is defined more than once.
+	ErrDuplicateSwitch = errors.New("switch has already been defined")
+	// ErrNoNodes is reported when no nodes descend from a switch.
+	ErrNoNodes = errors.New("switch has no nodes")
+
+	// ErrUnknownNode is returned when a node given to Eval is not in the
+	// topology.
+	ErrUnknownNode = errors.New("node not found in topology")
+	// ErrEvalFailed is returned when Eval can not select nodes for a request.
+	ErrEvalFailed = errors.New("failed to evaluate nodes tree")
+	// ErrUnknownName is returned when a name given to Distance is neither a
+	// switch nor a node of the topology.
+	ErrUnknownName = errors.New("switch or node not found in topology")
+	// ErrUnreachable is returned by Distance when no links connect the
+	// switches or nodes.
+	ErrUnreachable = errors.New("switches are not connected")
+
+	// ErrNoBlocks is returned when a block topology defines no blocks.
+	ErrNoBlocks = errors.New("no blocks configured")
+	// ErrUnknownPlugin is returned when loading with an unknown topology plugin.
+	ErrUnknownPlugin = errors.New("unknown topology plugin")
+	// ErrNoBlockNodes is reported when a block has no nodes.
+	ErrNoBlockNodes = errors.New("block has no nodes")
+	// ErrDuplicateBlock is reported when a block name is defined more than once.
+	ErrDuplicateBlock = errors.New("block has already been defined")
+	// ErrOverlappingBlocks is reported when a node is in more than one block.
+	ErrOverlappingBlocks = errors.New("node is already in another block")
+	// ErrUnequalBlocks is reported when a block does not have as many nodes
+	// as the base block, the largest block.
+	ErrUnequalBlocks = errors.New("block size differs from the base block size")
+	// ErrInvalidWeight is returned when a Weight= value is not a number.
+	ErrInvalidWeight = errors.New("invalid Weight")
+	// ErrInvalidBlockSize is reported when a BlockSizes= value is not a power
+	// of two multiple of the base block size.
+	ErrInvalidBlockSize = errors.New("invalid BlockSizes")
+)
+
+// ConfigError describes a problem found while loading a topology
+// configuration file. Err holds the cause, which can be matched with
+// errors.Is against the Err* variables of this package.
+type ConfigError struct {
+	// File is the configuration file name.
+	File string
+	// Line is the line number in File, 0 if not applicable.
+	Line int
+	// Switch is the name of the switch concerned, empty if not applicable.
+	Switch string
+	// Block is the name of the block concerned, empty if not applicable.
+	Block string
+	// Err is the cause of the error.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	msg := e.File
+	if e.Line > 0 {
+		msg += fmt.Sprintf(":%d", e.Line)
+	}
+	if e.Switch != "" {
+		msg += fmt.Sprintf(": switch %s", e.Switch)
+	}
+	if e.Block != "" {
+		msg += fmt.Sprintf(": block %s", e.Block)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is returned by a strict load when the configuration has
+// problems that a lenient load would only report and skip.
+type ValidationError struct {
+	// Diagnostics are the problems found, in file order.
+	Diagnostics []*ConfigError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Diagnostics))
+	for _, diag := range e.Diagnostics {
+		msgs = append(msgs, diag.Error())
+	}
+	return fmt.Sprintf("%d configuration problem(s) found:\n%s",
+		len(e.Diagnostics), strings.Join(msgs, "\n"))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Diagnostics))
+	for _, diag := range e.Diagnostics {
+		errs = append(errs, diag)
+	}
+	return errs
+}
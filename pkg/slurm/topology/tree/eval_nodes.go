@@ -1,7 +1,57 @@
 package tree
 
+import (
+	"container/list"
+)
+
 type topo_weight_info_t struct {
 	node_bitmap *bitstr_t
 	node_cnt    int
 	weight      uint64
 }
+
+/*
+ * Build a list of the nodes of node_bitmap grouped by scheduling weight,
+ * sorted by increasing weight.
+ */
+func (t *Topology) _build_node_weight_list(node_bitmap *bitstr_t) *list.List {
+	node_list := list.New()
+	for i := bit_ffs(node_bitmap); i >= 0; i = bit_ffs_from_bit(node_bitmap, i+1) {
+		weight := uint64(t.node_record_table[i].weight)
+
+		/* Find the group of this weight or where to insert it */
+		e := node_list.Front()
+		for ; e != nil && e.Value.(*topo_weight_info_t).weight < weight; e = e.Next() {
+		}
+		var nw *topo_weight_info_t
+		if e != nil && e.Value.(*topo_weight_info_t).weight == weight {
+			nw = e.Value.(*topo_weight_info_t)
+		} else {
+			nw = &topo_weight_info_t{
+				node_bitmap: bit_alloc(t.node_record_cnt),
+				node_cnt:    0,
+				weight:      weight,
+			}
+			if e != nil {
+				node_list.InsertBefore(nw, e)
+			} else {
+				node_list.PushBack(nw)
+			}
+		}
+		bit_set(nw.node_bitmap, i)
+		nw.node_cnt++
+	}
+
+	return node_list
+}
+
+/* Return the lowest weight group with nodes in node_bitmap, nil if none */
+func _topo_node_find(node_list *list.List, node_bitmap *bitstr_t) *topo_weight_info_t {
+	for e := node_list.Front(); e != nil; e = e.Next() {
+		nw := e.Value.(*topo_weight_info_t)
+		if bit_overlap_any(nw.node_bitmap, node_bitmap) {
+			return nw
+		}
+	}
+	return nil
+}
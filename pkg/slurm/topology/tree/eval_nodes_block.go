@@ -0,0 +1,218 @@
+package tree
+
+import (
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/slurm"
+)
+
+/*
+ * Compare blocks i and j for the remaining nodes of a job: a block with
+ * required nodes must be used anyway, then the block that fits the request
+ * with the fewest nodes, otherwise the block with the most nodes.
+ */
+func _block_compare(i, j int, block_node_cnt []int, block_required []bool, rem_nodes int) int {
+	if block_required[i] != block_required[j] {
+		if block_required[i] {
+			return 1
+		}
+		return -1
+	}
+
+	i_fit := block_node_cnt[i] >= rem_nodes
+	j_fit := block_node_cnt[j] >= rem_nodes
+	if i_fit && j_fit {
+		if block_node_cnt[i] < block_node_cnt[j] {
+			return 1
+		}
+		if block_node_cnt[i] > block_node_cnt[j] {
+			return -1
+		}
+		return 0
+	} else if i_fit {
+		return 1
+	} else if j_fit {
+		return -1
+	}
+
+	if block_node_cnt[i] > block_node_cnt[j] {
+		return 1
+	}
+	if block_node_cnt[i] < block_node_cnt[j] {
+		return -1
+	}
+	return 0
+}
+
+/*
+ * Allocate resources to the job within an aligned aggregation of base
+ * blocks, the smallest of the configured block sizes that fits the job.
+ */
+func (t *Topology) eval_nodes_block(topo_eval *topology_eval_t) int {
+	var (
+		block_node_bitmap []*bitstr_t /* nodes in this block */
+		block_node_cnt    []int       /* total nodes in block */
+		block_required    []bool      /* set if has required node */
+		req_nodes_bitmap  *bitstr_t   /* required node bitmap */
+		seg_node_bitmap   *bitstr_t   /* nodes in an aggregation of blocks */
+		rc                = slurm.SUCCESS
+		bblock_needed     = 0 /* base blocks needed by the job */
+		block_size        = 0 /* base blocks per aggregation */
+		best_seg          = -1
+		best_seg_node_cnt = 0
+		rem_nodes         = 0 /* remaining resources desired */
+	)
+
+	rem_nodes = int(topo_eval.req_nodes)
+
+	/* Validate availability of required nodes */
+	if topo_eval.req_node_bitmap != nil {
+		if !bit_super_set(topo_eval.req_node_bitmap, topo_eval.node_map) {
+			topo_eval._error("requires nodes which are not currently available")
+			rc = slurm.ERROR
+			goto fini
+		}
+
+		req_node_cnt := bit_set_count(topo_eval.req_node_bitmap)
+		if req_node_cnt == 0 {
+			topo_eval._error("required node list has no nodes")
+			rc = slurm.ERROR
+			goto fini
+		}
+
+		/* The requested node count is also the job's max */
+		if req_node_cnt > rem_nodes {
+			topo_eval._error("requires more nodes than job's max (%d>%d)",
+				req_node_cnt, rem_nodes)
+			rc = slurm.ERROR
+			goto fini
+		}
+
+		req_nodes_bitmap = topo_eval.req_node_bitmap
+	}
+
+	if bit_set_count(topo_eval.node_map) == 0 {
+		topo_eval._error("node_map is empty")
+		rc = slurm.ERROR
+		goto fini
+	}
+
+	block_node_bitmap = make([]*bitstr_t, t.block_record_cnt)
+	block_node_cnt = make([]int, t.block_record_cnt)
+	block_required = make([]bool, t.block_record_cnt)
+	for i := 0; i < t.block_record_cnt; i++ {
+		block_node_bitmap[i] = bit_copy(t.block_record_table[i].node_bitmap)
+		bit_and(block_node_bitmap[i], topo_eval.node_map)
+		block_node_cnt[i] = bit_set_count(block_node_bitmap[i])
+		block_required[i] = req_nodes_bitmap != nil &&
+			bit_overlap_any(req_nodes_bitmap, block_node_bitmap[i])
+	}
+
+	/* Smallest aggregation of base blocks the job fits in */
+	bblock_needed = (rem_nodes + t.bblock_node_cnt - 1) / t.bblock_node_cnt
+	for _, size := range t.block_sizes {
+		if size >= bblock_needed {
+			block_size = size
+			break
+		}
+	}
+	if block_size == 0 {
+		topo_eval._error("requires more nodes than the largest block size (%d>%d)",
+			rem_nodes, t.block_sizes[len(t.block_sizes)-1]*t.bblock_node_cnt)
+		rc = slurm.ERROR
+		goto fini
+	}
+
+	/*
+	 * Aggregations are aligned on their size. Pick the one holding all
+	 * required nodes with the fewest available nodes that satisfy the
+	 * request (less resource waste).
+	 */
+	seg_node_bitmap = bit_alloc(t.node_record_cnt)
+	for seg := 0; seg+block_size <= t.block_record_cnt; seg += block_size {
+		bit_clear_all(seg_node_bitmap)
+		for i := seg; i < seg+block_size; i++ {
+			bit_or(seg_node_bitmap, block_node_bitmap[i])
+		}
+		if req_nodes_bitmap != nil && !bit_super_set(req_nodes_bitmap, seg_node_bitmap) {
+			continue
+		}
+		seg_node_cnt := bit_set_count(seg_node_bitmap)
+		if !eval_nodes_enough_nodes(seg_node_cnt, rem_nodes) {
+			continue
+		}
+		if best_seg == -1 || seg_node_cnt < best_seg_node_cnt {
+			best_seg = seg
+			best_seg_node_cnt = seg_node_cnt
+		}
+	}
+	if best_seg == -1 {
+		topo_eval._error("insufficient resources currently available")
+		rc = slurm.ERROR
+		goto fini
+	}
+
+	if req_nodes_bitmap != nil {
+		bit_and(topo_eval.node_map, req_nodes_bitmap)
+		rem_nodes -= bit_set_count(req_nodes_bitmap)
+		if rem_nodes <= 0 {
+			/* Required nodes completely satisfied the request */
+			rc = slurm.SUCCESS
+			goto fini
+		}
+	} else {
+		bit_clear_all(topo_eval.node_map)
+	}
+
+	/* Use as few blocks of the aggregation as possible */
+	for rem_nodes > 0 {
+		best_block := -1
+		for i := best_seg; i < best_seg+block_size; i++ {
+			if block_node_cnt[i] == 0 {
+				continue
+			}
+			if best_block == -1 ||
+				_block_compare(i, best_block, block_node_cnt, block_required, rem_nodes) > 0 {
+				best_block = i
+			}
+		}
+		if best_block == -1 {
+			break
+		}
+
+		for j := bit_ffs(block_node_bitmap[best_block]); j >= 0; j = bit_ffs_from_bit(block_node_bitmap[best_block], j+1) {
+			if !bit_set(topo_eval.node_map, j) {
+				continue
+			}
+			rem_nodes--
+			if rem_nodes <= 0 {
+				break
+			}
+		}
+		block_node_cnt[best_block] = 0
+		block_required[best_block] = false
+	}
+
+	if rem_nodes > 0 {
+		topo_eval._error("insufficient resources currently available")
+		rc = slurm.ERROR
+	}
+
+fini:
+	if rc == slurm.SUCCESS {
+		block_cnt := uint16(0)
+		/* Count up blocks. */
+		for i := 0; i < t.block_record_cnt; i++ {
+			if bit_overlap_any(t.block_record_table[i].node_bitmap, topo_eval.node_map) {
+				block_cnt++
+				topo_eval.leaf_switches = append(topo_eval.leaf_switches, i)
+			}
+		}
+		log.Debugf("Allocated %d nodes (%s) on %d blocks",
+			bit_set_count(topo_eval.node_map), t.bitmap2node_name(topo_eval.node_map), block_cnt)
+		topo_eval.leaf_switch_cnt = block_cnt
+		topo_eval.top_switch_inx = -1
+	}
+
+	return rc
+}
@@ -0,0 +1,96 @@
+package tree
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/yeahdongcn/topology/pkg/slurm"
+)
+
+func Test_eval_nodes_block(t *testing.T) {
+	topo, err := Load(_write_topo_file(t,
+		"BlockName=b1 Nodes=n[00-03]\n"+
+			"BlockName=b2 Nodes=n[04-07]\n"+
+			"BlockName=b3 Nodes=n[08-11]\n"+
+			"BlockName=b4 Nodes=n[12-15]\n"))
+	require.NoError(t, err)
+	require.Equal(t, []int{4, 8, 16}, topo.BlockSizes())
+
+	/* The job fits in a base block */
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 3,
+	}
+	rc := topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"n00", "n01", "n02"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(1), eval.leaf_switch_cnt)
+
+	/* The base block with the fewest available nodes that fit the job */
+	avail := []string{"n00", "n01", "n04", "n05", "n06", "n08", "n09", "n10", "n11", "n12", "n13", "n14", "n15"}
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, avail...),
+		req_nodes: 3,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"n04", "n05", "n06"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(1), eval.leaf_switch_cnt)
+
+	/* Two base blocks, b1 and b2 together have too few nodes */
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, avail...),
+		req_nodes: 6,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"n08", "n09", "n10", "n11", "n12", "n13"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+
+	/* Aggregations are aligned, b2 and b3 can not be used together */
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, "n04", "n05", "n06", "n07", "n08", "n09", "n10", "n11"),
+		req_nodes: 8,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.ERROR, rc)
+
+	// With req_node_bitmap
+	eval = &topology_eval_t{
+		node_map:        node_bitmap(t, topo, avail...),
+		req_node_bitmap: node_bitmap(t, topo, "n00"),
+		req_nodes:       3,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.ERROR, rc)
+
+	eval = &topology_eval_t{
+		node_map:        node_bitmap(t, topo, avail...),
+		req_node_bitmap: node_bitmap(t, topo, "n00"),
+		req_nodes:       5,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"n00", "n01", "n04", "n05", "n06"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+
+	/* More required nodes than the job asks for */
+	var trace Trace
+	eval = &topology_eval_t{
+		node_map:        node_bitmap(t, topo, avail...),
+		req_node_bitmap: node_bitmap(t, topo, "n04", "n05", "n06"),
+		req_nodes:       2,
+		trace:           &trace,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.ERROR, rc)
+	require.Equal(t, "requires more nodes than job's max (3>2)", trace.StopReason)
+
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 17,
+	}
+	rc = topo.eval_nodes_block(eval)
+	require.Equal(t, slurm.ERROR, rc)
+}
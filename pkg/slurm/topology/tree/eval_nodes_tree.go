@@ -12,18 +12,18 @@ func eval_nodes_enough_nodes(avail_nodes, rem_nodes int) bool {
 	return avail_nodes >= rem_nodes
 }
 
-func _topo_add_dist(dist *[]uint32, inx int) {
-	for i := 0; i < switch_record_cnt; i++ {
-		if switch_record_table[inx].switches_dist[i] == INFINITE ||
+func (t *Topology) _topo_add_dist(dist *[]uint32, inx int) {
+	for i := 0; i < t.switch_record_cnt; i++ {
+		if t.switch_record_table[inx].switches_dist[i] == INFINITE ||
 			(*dist)[i] == INFINITE {
 			(*dist)[i] = INFINITE
 		} else {
-			(*dist)[i] += switch_record_table[inx].switches_dist[i]
+			(*dist)[i] += t.switch_record_table[inx].switches_dist[i]
 		}
 	}
 }
 
-func _topo_compare_switches(i, j uint16, switch_node_cnt *[]int, rem_nodes int) int {
+func (t *Topology) _topo_compare_switches(i, j uint16, switch_node_cnt *[]int, rem_nodes int) int {
 	for {
 		i_fit := (*switch_node_cnt)[i] >= rem_nodes
 		j_fit := (*switch_node_cnt)[j] >= rem_nodes
@@ -41,12 +41,12 @@ func _topo_compare_switches(i, j uint16, switch_node_cnt *[]int, rem_nodes int)
 			return -1
 		}
 
-		if ((switch_record_table[i].parent != i) ||
-			(switch_record_table[j].parent != j)) &&
-			(switch_record_table[i].parent !=
-				switch_record_table[j].parent) {
-			i = switch_record_table[i].parent
-			j = switch_record_table[j].parent
+		if ((t.switch_record_table[i].parent != i) ||
+			(t.switch_record_table[j].parent != j)) &&
+			(t.switch_record_table[i].parent !=
+				t.switch_record_table[j].parent) {
+			i = t.switch_record_table[i].parent
+			j = t.switch_record_table[j].parent
 			continue
 		}
 
@@ -59,53 +59,67 @@ func _topo_compare_switches(i, j uint16, switch_node_cnt *[]int, rem_nodes int)
 	if (*switch_node_cnt)[i] < (*switch_node_cnt)[j] {
 		return -1
 	}
-	if switch_record_table[i].level < switch_record_table[j].level {
+	if t.switch_record_table[i].level < t.switch_record_table[j].level {
 		return 1
 	}
-	if switch_record_table[i].level > switch_record_table[j].level {
+	if t.switch_record_table[i].level > t.switch_record_table[j].level {
 		return -1
 	}
 	return 0
 }
 
-func _topo_choose_best_switch(dist *[]uint32, switch_node_cnt *[]int, rem_nodes int, i int, best_switch *int) {
+func (t *Topology) _topo_choose_best_switch(dist *[]uint32, switch_node_cnt *[]int, rem_nodes int, i int, best_switch *int, step *TraceStep) {
+	candidate := t._trace_candidate(step, dist, switch_node_cnt, i)
 	if *best_switch == -1 || (*dist)[i] == INFINITE || (*switch_node_cnt)[i] == 0 {
 		/*
 		 * If first possibility
 		 */
 		if (*switch_node_cnt)[i] > 0 && (*dist)[i] < INFINITE {
+			if candidate != nil {
+				candidate.Preferred = true
+			}
 			*best_switch = i
 		}
 		return
 	}
 
-	tcs := _topo_compare_switches(uint16(i), uint16(*best_switch), switch_node_cnt, rem_nodes)
+	tcs := t._topo_compare_switches(uint16(i), uint16(*best_switch), switch_node_cnt, rem_nodes)
+	if candidate != nil {
+		candidate.Best = t.switch_record_table[*best_switch].name
+		candidate.Fit = tcs
+	}
 	if ((*dist)[i] < (*dist)[*best_switch] && tcs >= 0) ||
 		((*dist)[i] == (*dist)[*best_switch] && tcs > 0) {
 		/*
 		 * If closer and fit request OR
 		 * same distance and tightest fit (less resource waste)
 		 */
+		if candidate != nil {
+			candidate.Preferred = true
+		}
 		*best_switch = i
 	}
 }
 
 /* Allocate resources to job using a minimal leaf switch count */
-func _eval_nodes_topo(topo_eval *topology_eval_t) int {
+func (t *Topology) _eval_nodes_topo(topo_eval *topology_eval_t) int {
 	var (
-		switch_node_bitmap []*bitstr_t /* nodes on this switch */
-		switch_node_cnt    []int       /* total nodes on switch */
-		switch_required    []int       /* set if has required node */
-		req_nodes_bitmap   *bitstr_t   /* required node bitmap */
-		best_nodes_bitmap  *bitstr_t   /* required+low priority nodes */
-		best_node_cnt      = 0
-		node_weight_list   *list.List
-		rc                 = slurm.SUCCESS
-		top_switch_inx     = -1
-		rem_nodes          = 0 /* remaining resources desired */
-		prev_rem_nodes     = 0
-		switches_dist      []uint32
-		sufficient         = false
+		switch_node_bitmap       []*bitstr_t /* nodes on this switch */
+		switch_node_cnt          []int       /* total nodes on switch */
+		switch_required          []int       /* set if has required node */
+		req_nodes_bitmap         *bitstr_t   /* required node bitmap */
+		req2_nodes_bitmap        *bitstr_t   /* required+lowest prio nodes */
+		best_nodes_bitmap        *bitstr_t   /* required+low priority nodes */
+		best_node_cnt            = 0
+		node_weight_list         *list.List
+		rc                       = slurm.SUCCESS
+		top_switch_inx           = -1
+		top_switch_lowest_weight uint64
+		rem_nodes                = 0 /* remaining resources desired */
+		prev_rem_nodes           = 0
+		switches_dist            []uint32
+		sufficient               = false
+		requested                = false
 	)
 
 	rem_nodes = int(topo_eval.req_nodes)
@@ -113,21 +127,21 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 	/* Validate availability of required nodes */
 	if topo_eval.req_node_bitmap != nil {
 		if !bit_super_set(topo_eval.req_node_bitmap, topo_eval.node_map) {
-			log.Error("requires nodes which are not currently available")
+			topo_eval._error("requires nodes which are not currently available")
 			rc = slurm.ERROR
 			goto fini
 		}
 
 		req_node_cnt := bit_set_count(topo_eval.req_node_bitmap)
 		if req_node_cnt == 0 {
-			log.Error("required node list has no nodes")
+			topo_eval._error("required node list has no nodes")
 			rc = slurm.ERROR
 			goto fini
 		}
 
 		max_nodes := bit_set_count(topo_eval.node_map)
 		if req_node_cnt > max_nodes {
-			log.Errorf("requires more nodes than currently available (%d>%d)",
+			topo_eval._error("requires more nodes than currently available (%d>%d)",
 				req_node_cnt, max_nodes)
 			rc = slurm.ERROR
 			goto fini
@@ -141,43 +155,25 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 	 * build list of node bitmaps, sorted by weight
 	 */
 	if bit_set_count(topo_eval.node_map) == 0 {
-		log.Error("node_map is empty")
+		topo_eval._error("node_map is empty")
 		rc = slurm.ERROR
 		goto fini
 	}
-	node_weight_list = list.New()
-	for i := 0; i < bit_set_count(topo_eval.node_map); i++ {
-		node_ptr := (*topo_eval.node_map)[i]
-		if req_nodes_bitmap != nil && bit_test(req_nodes_bitmap, node_ptr) {
-			rem_nodes--
-		}
-
-		var nw *topo_weight_info_t
-		if node_weight_list.Front() == nil {
-			nw = &topo_weight_info_t{
-				node_bitmap: &bitstr_t{},
-				node_cnt:    0,
-				weight:      0,
-			}
-
-			node_weight_list.PushBack(nw)
-		} else {
-			nw = node_weight_list.Front().Value.(*topo_weight_info_t)
-		}
-		bit_set(nw.node_bitmap, node_ptr)
-		nw.node_cnt++
+	if req_nodes_bitmap != nil {
+		rem_nodes -= bit_set_count(req_nodes_bitmap)
 	}
+	node_weight_list = t._build_node_weight_list(topo_eval.node_map)
 
 	/*
 	 * Identify the highest level switch to be used.
 	 * Note that nodes can be on multiple non-overlapping switches.
 	 */
-	switch_node_bitmap = make([]*bitstr_t, switch_record_cnt)
-	switch_node_cnt = make([]int, switch_record_cnt)
-	switch_required = make([]int, switch_record_cnt)
+	switch_node_bitmap = make([]*bitstr_t, t.switch_record_cnt)
+	switch_node_cnt = make([]int, t.switch_record_cnt)
+	switch_required = make([]int, t.switch_record_cnt)
 
-	for i := 0; i < switch_record_cnt; i++ {
-		switch_ptr := switch_record_table[i]
+	for i := 0; i < t.switch_record_cnt; i++ {
+		switch_ptr := t.switch_record_table[i]
 		switch_node_bitmap[i] = bit_copy(switch_ptr.node_bitmap)
 		bit_and(switch_node_bitmap[i], topo_eval.node_map)
 		switch_node_cnt[i] = bit_set_count(switch_node_bitmap[i])
@@ -185,7 +181,7 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 		if req_nodes_bitmap != nil && bit_overlap_any(req_nodes_bitmap, switch_node_bitmap[i]) {
 			switch_required[i] = 1
 			if (top_switch_inx == -1) ||
-				(switch_record_table[i].level > switch_record_table[top_switch_inx].level) {
+				(t.switch_record_table[i].level > t.switch_record_table[top_switch_inx].level) {
 				top_switch_inx = i
 			}
 		}
@@ -195,9 +191,12 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 		}
 
 		if req_nodes_bitmap == nil {
-			if (top_switch_inx == -1) ||
-				switch_record_table[i].level >= switch_record_table[top_switch_inx].level {
+			nw := _topo_node_find(node_weight_list, switch_node_bitmap[i])
+			if nw != nil && ((top_switch_inx == -1) ||
+				((t.switch_record_table[i].level >= t.switch_record_table[top_switch_inx].level) &&
+					(nw.weight <= top_switch_lowest_weight))) {
 				top_switch_inx = i
+				top_switch_lowest_weight = nw.weight
 			}
 		}
 	}
@@ -213,16 +212,17 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 	 * disjoint topology and available nodes living on different switches.
 	 */
 	if top_switch_inx == -1 {
-		log.Error("unable to identify top level switch")
+		topo_eval._error("unable to identify top level switch")
 		rc = slurm.ERROR
 		goto fini
 	}
+	t._trace_top_switch(topo_eval, top_switch_inx, req_nodes_bitmap != nil, rem_nodes, top_switch_lowest_weight)
 
 	/* Check that all specifically required nodes are on shared network */
 	if req_nodes_bitmap != nil &&
 		!bit_super_set(req_nodes_bitmap,
 			switch_node_bitmap[top_switch_inx]) {
-		log.Error("required nodes are not on shared network")
+		topo_eval._error("required nodes are not on shared network")
 		rc = slurm.ERROR
 		goto fini
 	}
@@ -231,7 +231,7 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 	 * Remove nodes from consideration that can not be reached from this
 	 * top level switch.
 	 */
-	for i := 0; i < switch_record_cnt; i++ {
+	for i := 0; i < t.switch_record_cnt; i++ {
 		if top_switch_inx != i {
 			bit_and(switch_node_bitmap[i], switch_node_bitmap[top_switch_inx])
 		}
@@ -241,14 +241,12 @@ func _eval_nodes_topo(topo_eval *topology_eval_t) int {
 		bit_and(topo_eval.node_map, req_nodes_bitmap)
 		if rem_nodes <= 0 {
 			/* Required nodes completely satisfied the request */
+			topo_eval._trace_stop("required nodes completely satisfied the request")
 			rc = slurm.SUCCESS
 			goto fini
 		}
 	}
 
-	goto try_again
-
-try_again:
 	/*
 	 * Identify the best set of nodes (i.e. nodes with the lowest weight,
 	 * in addition to the required nodes) that can be used to satisfy the
@@ -258,19 +256,34 @@ try_again:
 	 * Later logic selects from those nodes to get the best topology.
 	 */
 	best_node_cnt = 0
-	best_nodes_bitmap = &bitstr_t{}
-	for e := node_weight_list.Front(); e != nil; e = e.Next() {
+	best_nodes_bitmap = bit_alloc(t.node_record_cnt)
+	for e := node_weight_list.Front(); !requested && e != nil; e = e.Next() {
 		nw := e.Value.(*topo_weight_info_t)
+		if best_node_cnt > 0 {
+			/*
+			 * All of the lower priority nodes should be included
+			 * in the job's allocation. Nodes from the next highest
+			 * weight nodes are included only as needed.
+			 */
+			if req2_nodes_bitmap != nil {
+				bit_or(req2_nodes_bitmap, best_nodes_bitmap)
+			} else {
+				req2_nodes_bitmap = bit_copy(best_nodes_bitmap)
+			}
+		}
+
 		if bit_set_count(nw.node_bitmap) == 0 {
 			continue
 		}
 
-		for i := 0; i < bit_set_count(nw.node_bitmap); i++ {
-			node_ptr := (*nw.node_bitmap)[i]
-			if !bit_test(switch_node_bitmap[top_switch_inx], node_ptr) {
+		for i := bit_ffs(nw.node_bitmap); i >= 0; i = bit_ffs_from_bit(nw.node_bitmap, i+1) {
+			if req_nodes_bitmap != nil && bit_test(req_nodes_bitmap, i) {
+				continue /* Required node */
+			}
+			if !bit_test(switch_node_bitmap[top_switch_inx], i) {
 				continue
 			}
-			if bit_set(best_nodes_bitmap, node_ptr) {
+			if bit_set(best_nodes_bitmap, i) {
 				best_node_cnt++
 			}
 		}
@@ -278,38 +291,68 @@ try_again:
 		if !sufficient {
 			sufficient = eval_nodes_enough_nodes(best_node_cnt, rem_nodes)
 		}
+		requested = best_node_cnt >= rem_nodes
 	}
 
 	if !sufficient {
-		log.Error("insufficient resources currently available")
+		topo_eval._error("insufficient resources currently available")
 		rc = slurm.ERROR
 		goto fini
 	}
 
+	/*
+	 * Add lowest weight nodes. Treat similar to required nodes for the job.
+	 * Job will still need to add some higher weight nodes later.
+	 */
+	if req2_nodes_bitmap != nil {
+		for i := bit_ffs(req2_nodes_bitmap); i >= 0; i = bit_ffs_from_bit(req2_nodes_bitmap, i+1) {
+			rem_nodes--
+			bit_set(topo_eval.node_map, i)
+		}
+
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if switch_required[i] == 1 {
+				continue
+			}
+			if bit_overlap_any(req2_nodes_bitmap, switch_node_bitmap[i]) {
+				switch_required[i] = 1
+			}
+		}
+
+		if rem_nodes <= 0 {
+			/* Required nodes completely satisfied the request */
+			topo_eval._error("scheduling anomaly, lowest weight nodes completely satisfied the request")
+			rc = slurm.SUCCESS
+			goto fini
+		}
+	}
+
 	/*
 	 * Construct a set of switch array entries.
-	 * Use the same indexes as switch_record_table in slurmctld.
+	 * Use the same indexes as t.switch_record_table in slurmctld.
 	 */
 	bit_or(best_nodes_bitmap, topo_eval.node_map)
-	for i := 0; i < switch_record_cnt; i++ {
+	for i := 0; i < t.switch_record_cnt; i++ {
 		bit_and(switch_node_bitmap[i], best_nodes_bitmap)
 		switch_node_cnt[i] = bit_set_count(switch_node_bitmap[i])
 	}
 
 	/* Add additional resources for already required leaf switches */
-	if req_nodes_bitmap != nil {
-		for i := 0; i < switch_record_cnt; i++ {
+	if req_nodes_bitmap != nil || req2_nodes_bitmap != nil {
+		for i := 0; i < t.switch_record_cnt; i++ {
 			if switch_required[i] == 0 || switch_node_bitmap[i] == nil ||
-				switch_record_table[i].level != 0 {
+				t.switch_record_table[i].level != 0 {
 				continue
 			}
-			for j := 0; j < bit_set_count(switch_node_bitmap[i]); j++ {
-				if bit_test(topo_eval.node_map, (*switch_node_bitmap[i])[j]) {
+			for j := bit_ffs(switch_node_bitmap[i]); j >= 0; j = bit_ffs_from_bit(switch_node_bitmap[i], j+1) {
+				if bit_test(topo_eval.node_map, j) {
 					continue
 				}
 				rem_nodes--
-				bit_set(topo_eval.node_map, (*switch_node_bitmap[i])[j])
+				bit_set(topo_eval.node_map, j)
 				if rem_nodes <= 0 {
+					topo_eval._trace_stop("request satisfied from required leaf switch %s",
+						t.switch_record_table[i].name)
 					rc = slurm.SUCCESS
 					goto fini
 				}
@@ -317,11 +360,11 @@ try_again:
 		}
 	}
 
-	switches_dist = make([]uint32, switch_record_cnt)
+	switches_dist = make([]uint32, t.switch_record_cnt)
 
-	for i := 0; i < switch_record_cnt; i++ {
+	for i := 0; i < t.switch_record_cnt; i++ {
 		if switch_required[i] == 1 {
-			_topo_add_dist(&switches_dist, i)
+			t._topo_add_dist(&switches_dist, i)
 		}
 	}
 	/* Add additional resources as required from additional leaf switches */
@@ -329,56 +372,69 @@ try_again:
 	for {
 		best_switch_inx := -1
 		if prev_rem_nodes == rem_nodes {
+			topo_eval._error("insufficient resources currently available, no nodes added by the last leaf switch")
 			break /* Stalled */
 		}
 		prev_rem_nodes = rem_nodes
 
-		for i := 0; i < switch_record_cnt; i++ {
-			if switch_record_table[i].level != 0 {
+		step := topo_eval._trace_step(rem_nodes)
+		for i := 0; i < t.switch_record_cnt; i++ {
+			/* Required leaf switches have no nodes left to add */
+			if switch_required[i] == 1 || t.switch_record_table[i].level != 0 {
 				continue
 			}
-			_topo_choose_best_switch(&switches_dist, &switch_node_cnt, rem_nodes, i, &best_switch_inx)
+			t._topo_choose_best_switch(&switches_dist, &switch_node_cnt, rem_nodes, i, &best_switch_inx, step)
 		}
 		if best_switch_inx == -1 {
+			topo_eval._error("insufficient resources currently available, no reachable leaf switch with nodes left")
 			break
 		}
+		if step != nil {
+			step.Chosen = t.switch_record_table[best_switch_inx].name
+		}
 
-		_topo_add_dist(&switches_dist, best_switch_inx)
+		t._topo_add_dist(&switches_dist, best_switch_inx)
 		/*
 		 * NOTE: Ideally we would add nodes in order of resource
 		 * availability rather than in order of bitmap position, but
 		 * that would add even more complexity and overhead.
 		 */
-		for i := 0; i < bit_set_count(switch_node_bitmap[best_switch_inx]); i++ {
-			node_ptr := (*switch_node_bitmap[best_switch_inx])[i]
-			if bit_test(topo_eval.node_map, node_ptr) {
+		for i := bit_ffs(switch_node_bitmap[best_switch_inx]); i >= 0; i = bit_ffs_from_bit(switch_node_bitmap[best_switch_inx], i+1) {
+			if bit_test(topo_eval.node_map, i) {
 				continue
 			}
-			if bit_set(topo_eval.node_map, node_ptr) {
+			if bit_set(topo_eval.node_map, i) {
 				rem_nodes--
 			}
 			if rem_nodes <= 0 {
+				topo_eval._trace_stop("request satisfied from leaf switch %s",
+					t.switch_record_table[best_switch_inx].name)
 				rc = slurm.SUCCESS
 				goto fini
 			}
 		}
 		switch_node_cnt[best_switch_inx] = 0 /* Used all */
 	}
+	rc = slurm.ERROR
 
 fini:
 	if rc == slurm.SUCCESS {
 		leaf_switch_cnt := uint16(0)
 		/* Count up leaf switches. */
-		for i := 0; i < switch_record_cnt; i++ {
-			if switch_record_table[i].level != 0 {
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if t.switch_record_table[i].level != 0 {
 				continue
 			}
 			if bit_overlap_any(switch_node_bitmap[i], topo_eval.node_map) {
 				leaf_switch_cnt++
+				topo_eval.leaf_switches = append(topo_eval.leaf_switches, i)
 			}
 		}
-		log.Debugf("Allocated %d nodes on %d leaf switches", bit_set_count(topo_eval.node_map), leaf_switch_cnt)
+		log.Debugf("Allocated %d nodes (%s) on %d leaf switches",
+			bit_set_count(topo_eval.node_map), t.bitmap2node_name(topo_eval.node_map), leaf_switch_cnt)
 		topo_eval.leaf_switch_cnt = leaf_switch_cnt
+		topo_eval.top_switch_inx = top_switch_inx
+		topo_eval.switches_dist = switches_dist
 	}
 
 	return rc
@@ -388,14 +444,345 @@ fini:
  * Allocate resources to the job on one leaf switch if possible,
  * otherwise distribute the job allocation over many leaf switches.
  */
-func _eval_nodes_dfly(topo_eval *topology_eval_t) int {
-	return 0
+func (t *Topology) _eval_nodes_dfly(topo_eval *topology_eval_t) int {
+	var (
+		switch_node_bitmap       []*bitstr_t /* nodes on this switch */
+		switch_node_cnt          []int       /* total nodes on switch */
+		switch_required          []int       /* set if has required node */
+		avail_nodes_bitmap       *bitstr_t   /* nodes on any switch */
+		req_nodes_bitmap         *bitstr_t   /* required node bitmap */
+		req2_nodes_bitmap        *bitstr_t   /* required+lowest prio nodes */
+		best_nodes_bitmap        *bitstr_t   /* required+low prio nodes */
+		best_node_cnt            = 0
+		node_weight_list         *list.List
+		rc                       = slurm.SUCCESS
+		top_switch_inx           = -1
+		top_switch_lowest_weight uint64
+		leaf_switch_count        = 0
+		rem_nodes                = 0 /* remaining resources desired */
+		prev_rem_nodes           = 0
+		sufficient               = false
+	)
+
+	rem_nodes = int(topo_eval.req_nodes)
+
+	/* Validate availability of required nodes */
+	if topo_eval.req_node_bitmap != nil {
+		if !bit_super_set(topo_eval.req_node_bitmap, topo_eval.node_map) {
+			topo_eval._error("requires nodes which are not currently available")
+			rc = slurm.ERROR
+			goto fini
+		}
+
+		req_node_cnt := bit_set_count(topo_eval.req_node_bitmap)
+		if req_node_cnt == 0 {
+			topo_eval._error("required node list has no nodes")
+			rc = slurm.ERROR
+			goto fini
+		}
+
+		max_nodes := bit_set_count(topo_eval.node_map)
+		if req_node_cnt > max_nodes {
+			topo_eval._error("requires more nodes than currently available (%d>%d)",
+				req_node_cnt, max_nodes)
+			rc = slurm.ERROR
+			goto fini
+		}
+
+		req_nodes_bitmap = topo_eval.req_node_bitmap
+	}
+
+	/*
+	 * Add required nodes to job allocation and
+	 * build list of node bitmaps, sorted by weight
+	 */
+	if bit_set_count(topo_eval.node_map) == 0 {
+		topo_eval._error("node_map is empty")
+		rc = slurm.ERROR
+		goto fini
+	}
+	if req_nodes_bitmap != nil {
+		rem_nodes -= bit_set_count(req_nodes_bitmap)
+	}
+	node_weight_list = t._build_node_weight_list(topo_eval.node_map)
+
+	/*
+	 * Identify the highest level switch to be used.
+	 * Note that nodes can be on multiple non-overlapping switches.
+	 */
+	switch_node_bitmap = make([]*bitstr_t, t.switch_record_cnt)
+	switch_node_cnt = make([]int, t.switch_record_cnt)
+	switch_required = make([]int, t.switch_record_cnt)
+
+	for i := 0; i < t.switch_record_cnt; i++ {
+		switch_ptr := t.switch_record_table[i]
+		switch_node_bitmap[i] = bit_copy(switch_ptr.node_bitmap)
+		bit_and(switch_node_bitmap[i], topo_eval.node_map)
+		switch_node_cnt[i] = bit_set_count(switch_node_bitmap[i])
+
+		if req_nodes_bitmap != nil && bit_overlap_any(req_nodes_bitmap, switch_node_bitmap[i]) {
+			switch_required[i] = 1
+			if switch_ptr.level == 0 {
+				leaf_switch_count++
+			}
+			if (top_switch_inx == -1) ||
+				(switch_ptr.level > t.switch_record_table[top_switch_inx].level) {
+				top_switch_inx = i
+			}
+		}
+
+		if !eval_nodes_enough_nodes(switch_node_cnt[i], rem_nodes) {
+			continue
+		}
+
+		if req_nodes_bitmap == nil {
+			nw := _topo_node_find(node_weight_list, switch_node_bitmap[i])
+			if nw != nil && ((top_switch_inx == -1) ||
+				((switch_ptr.level >= t.switch_record_table[top_switch_inx].level) &&
+					(nw.weight <= top_switch_lowest_weight))) {
+				top_switch_inx = i
+				top_switch_lowest_weight = nw.weight
+			}
+		}
+	}
+
+	if req_nodes_bitmap == nil {
+		bit_clear_all(topo_eval.node_map)
+	}
+
+	/*
+	 * Top switch is highest level switch containing all required nodes
+	 * OR all nodes of the lowest scheduling weight
+	 * OR -1 of can not identify top-level switch
+	 */
+	if top_switch_inx == -1 {
+		topo_eval._error("unable to identify top level switch")
+		rc = slurm.ERROR
+		goto fini
+	}
+	t._trace_top_switch(topo_eval, top_switch_inx, req_nodes_bitmap != nil, rem_nodes, top_switch_lowest_weight)
+
+	/* Check that all specifically required nodes are on shared network */
+	if req_nodes_bitmap != nil &&
+		!bit_super_set(req_nodes_bitmap,
+			switch_node_bitmap[top_switch_inx]) {
+		topo_eval._error("required nodes are not on shared network")
+		rc = slurm.ERROR
+		goto fini
+	}
+
+	/*
+	 * Remove nodes from consideration that can not be reached from this
+	 * top level switch
+	 */
+	for i := 0; i < t.switch_record_cnt; i++ {
+		if top_switch_inx != i {
+			bit_and(switch_node_bitmap[i], switch_node_bitmap[top_switch_inx])
+		}
+	}
+
+	if req_nodes_bitmap != nil {
+		bit_and(topo_eval.node_map, req_nodes_bitmap)
+		if rem_nodes <= 0 {
+			/* Required nodes completely satisfied the request */
+			topo_eval._trace_stop("required nodes completely satisfied the request")
+			rc = slurm.SUCCESS
+			goto fini
+		}
+	}
+
+	/*
+	 * Identify the best set of nodes (i.e. nodes with the lowest weight,
+	 * in addition to the required nodes) that can be used to satisfy the
+	 * job request. All nodes must be on a common top-level switch. The
+	 * logic here adds groups of nodes, all with the same weight, so we
+	 * usually identify more nodes than required to satisfy the request.
+	 * Later logic selects from those nodes to get the best topology.
+	 */
+	best_nodes_bitmap = bit_alloc(t.node_record_cnt)
+	for e := node_weight_list.Front(); !sufficient && e != nil; e = e.Next() {
+		nw := e.Value.(*topo_weight_info_t)
+		if best_node_cnt > 0 {
+			/*
+			 * All of the lower priority nodes should be included
+			 * in the job's allocation. Nodes from the next highest
+			 * weight nodes are included only as needed.
+			 */
+			if req2_nodes_bitmap != nil {
+				bit_or(req2_nodes_bitmap, best_nodes_bitmap)
+			} else {
+				req2_nodes_bitmap = bit_copy(best_nodes_bitmap)
+			}
+		}
+		for i := bit_ffs(nw.node_bitmap); i >= 0; i = bit_ffs_from_bit(nw.node_bitmap, i+1) {
+			if req_nodes_bitmap != nil && bit_test(req_nodes_bitmap, i) {
+				continue /* Required node */
+			}
+			if !bit_test(switch_node_bitmap[top_switch_inx], i) {
+				continue
+			}
+			if bit_set(best_nodes_bitmap, i) {
+				best_node_cnt++
+			}
+		}
+
+		sufficient = eval_nodes_enough_nodes(best_node_cnt, rem_nodes)
+	}
+
+	if !sufficient {
+		topo_eval._error("insufficient resources currently available")
+		rc = slurm.ERROR
+		goto fini
+	}
+
+	/*
+	 * Add lowest weight nodes. Treat similar to required nodes for the job.
+	 * Job will still need to add some higher weight nodes later.
+	 */
+	if req2_nodes_bitmap != nil {
+		for i := bit_ffs(req2_nodes_bitmap); i >= 0; i = bit_ffs_from_bit(req2_nodes_bitmap, i+1) {
+			rem_nodes--
+			bit_set(topo_eval.node_map, i)
+		}
+
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if switch_required[i] == 1 {
+				continue
+			}
+			if bit_overlap_any(req2_nodes_bitmap, switch_node_bitmap[i]) {
+				switch_required[i] = 1
+				if t.switch_record_table[i].level == 0 {
+					leaf_switch_count++
+				}
+			}
+		}
+		if rem_nodes <= 0 {
+			/* Required nodes completely satisfied the request */
+			topo_eval._error("scheduling anomaly, lowest weight nodes completely satisfied the request")
+			rc = slurm.SUCCESS
+			goto fini
+		}
+	}
+
+	/*
+	 * Construct a set of switch array entries,
+	 * use the same indexes as switch_record_table in slurmctld
+	 */
+	bit_or(best_nodes_bitmap, topo_eval.node_map)
+	avail_nodes_bitmap = bit_alloc(t.node_record_cnt)
+	for i := 0; i < t.switch_record_cnt; i++ {
+		bit_and(switch_node_bitmap[i], best_nodes_bitmap)
+		bit_or(avail_nodes_bitmap, switch_node_bitmap[i])
+		switch_node_cnt[i] = bit_set_count(switch_node_bitmap[i])
+	}
+
+	if req_nodes_bitmap != nil && !bit_super_set(req_nodes_bitmap, avail_nodes_bitmap) {
+		topo_eval._error("requires nodes not available on any switch")
+		rc = slurm.ERROR
+		goto fini
+	}
+
+	/*
+	 * If no resources have yet been selected,
+	 * then pick one leaf switch with the most available nodes.
+	 */
+	if leaf_switch_count == 0 {
+		best_switch_inx := -1
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if t.switch_record_table[i].level != 0 {
+				continue
+			}
+			if (best_switch_inx == -1) ||
+				(switch_node_cnt[i] > switch_node_cnt[best_switch_inx]) {
+				best_switch_inx = i
+			}
+		}
+		if best_switch_inx != -1 {
+			leaf_switch_count = 1
+			switch_required[best_switch_inx] = 1
+		}
+	}
+
+	/* Add additional resources for already required leaf switches */
+	for i := 0; i < t.switch_record_cnt; i++ {
+		if switch_required[i] == 0 || t.switch_record_table[i].level != 0 {
+			continue
+		}
+		for j := bit_ffs(switch_node_bitmap[i]); j >= 0; j = bit_ffs_from_bit(switch_node_bitmap[i], j+1) {
+			if bit_test(topo_eval.node_map, j) {
+				continue
+			}
+			rem_nodes--
+			bit_set(topo_eval.node_map, j)
+			if rem_nodes <= 0 {
+				topo_eval._trace_stop("request satisfied from required leaf switch %s",
+					t.switch_record_table[i].name)
+				rc = slurm.SUCCESS
+				goto fini
+			}
+		}
+	}
+
+	/*
+	 * Add additional resources as required from additional leaf switches
+	 * on a round-robin basis
+	 */
+	prev_rem_nodes = rem_nodes + 1
+	for {
+		if prev_rem_nodes == rem_nodes {
+			break /* Stalled */
+		}
+		prev_rem_nodes = rem_nodes
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if t.switch_record_table[i].level != 0 {
+				continue
+			}
+			for j := bit_ffs(switch_node_bitmap[i]); j >= 0; j = bit_ffs_from_bit(switch_node_bitmap[i], j+1) {
+				if bit_test(topo_eval.node_map, j) {
+					continue
+				}
+				rem_nodes--
+				bit_set(topo_eval.node_map, j)
+				if rem_nodes <= 0 {
+					topo_eval._trace_stop("request satisfied round-robin from leaf switch %s",
+						t.switch_record_table[i].name)
+					rc = slurm.SUCCESS
+					goto fini
+				}
+				break
+			}
+		}
+	}
+
+	topo_eval._error("insufficient resources currently available")
+	rc = slurm.ERROR
+
+fini:
+	if rc == slurm.SUCCESS {
+		leaf_switch_cnt := uint16(0)
+		/* Count up leaf switches. */
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if t.switch_record_table[i].level != 0 {
+				continue
+			}
+			if bit_overlap_any(t.switch_record_table[i].node_bitmap, topo_eval.node_map) {
+				leaf_switch_cnt++
+				topo_eval.leaf_switches = append(topo_eval.leaf_switches, i)
+			}
+		}
+		log.Debugf("Allocated %d nodes (%s) on %d leaf switches",
+			bit_set_count(topo_eval.node_map), t.bitmap2node_name(topo_eval.node_map), leaf_switch_cnt)
+		topo_eval.leaf_switch_cnt = leaf_switch_cnt
+		topo_eval.top_switch_inx = top_switch_inx
+	}
+
+	return rc
 }
 
-func eval_nodes_tree(topo_eval *topology_eval_t, have_dragonfly bool) int {
+func (t *Topology) eval_nodes_tree(topo_eval *topology_eval_t, have_dragonfly bool) int {
 	if have_dragonfly {
-		return _eval_nodes_dfly(topo_eval)
+		return t._eval_nodes_dfly(topo_eval)
 	} else {
-		return _eval_nodes_topo(topo_eval)
+		return t._eval_nodes_topo(topo_eval)
 	}
 }
@@ -3,6 +3,8 @@ package tree
 import (
 	"fmt"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -10,8 +12,40 @@ import (
 	"github.com/yeahdongcn/topology/pkg/slurm"
 )
 
+func node_bitmap(tb testing.TB, topo *Topology, names ...string) *bitstr_t {
+	bitmap, err := topo._node_list2bitmap(names)
+	require.NoError(tb, err)
+	return bitmap
+}
+
+/*
+ * _synthetic_topology writes a three level fat tree with the given number of
+ * leaf switches and nodes per leaf switch, and loads it.
+ */
+func _synthetic_topology(tb testing.TB, leaf_cnt, nodes_per_leaf int) *Topology {
+	filename := filepath.Join(tb.TempDir(), "topology.conf")
+	f, err := os.Create(filename)
+	require.NoError(tb, err)
+
+	spine_cnt := (leaf_cnt + 15) / 16
+	for i := 0; i < leaf_cnt; i++ {
+		fmt.Fprintf(f, "SwitchName=leaf%d Nodes=node[%05d-%05d]\n",
+			i, i*nodes_per_leaf, (i+1)*nodes_per_leaf-1)
+	}
+	for i := 0; i < spine_cnt; i++ {
+		fmt.Fprintf(f, "SwitchName=spine%d Switches=leaf[%d-%d]\n",
+			i, i*16, min((i+1)*16, leaf_cnt)-1)
+	}
+	fmt.Fprintf(f, "SwitchName=core Switches=spine[0-%d]\n", spine_cnt-1)
+	require.NoError(tb, f.Close())
+
+	topo, err := Load(filename)
+	require.NoError(tb, err)
+	return topo
+}
+
 func Benchmark_eval_nodes_tree_topo3(b *testing.B) {
-	err := switch_record_validate("../../../../test/topology3.conf")
+	topo, err := Load("../../../../test/topology3.conf")
 	require.NoError(b, err)
 
 	for i := 0; i < b.N; i++ {
@@ -20,98 +54,372 @@ func Benchmark_eval_nodes_tree_topo3(b *testing.B) {
 			x := rand.Intn(100)
 			avns = append(avns, "worker"+fmt.Sprintf("%03d", x))
 		}
-		node_map := bitstr_t(avns)
+		avns_in_topo := []string{}
+		for _, name := range avns {
+			if topo._find_node_inx(name) >= 0 {
+				avns_in_topo = append(avns_in_topo, name)
+			}
+		}
 		eval := &topology_eval_t{
-			node_map:  &node_map,
+			node_map:  node_bitmap(b, topo, avns_in_topo...),
 			req_nodes: 4,
 		}
-		err := eval_nodes_tree(eval, false)
+		err := topo.eval_nodes_tree(eval, false)
 		require.Equal(b, slurm.SUCCESS, err)
 	}
 }
 
+func Benchmark_eval_nodes_tree_synthetic(b *testing.B) {
+	for _, size := range []struct {
+		leaf_cnt, nodes_per_leaf int
+	}{
+		{32, 32},  /* 1,024 nodes */
+		{125, 32}, /* 4,000 nodes */
+		{256, 64}, /* 16,384 nodes */
+	} {
+		topo := _synthetic_topology(b, size.leaf_cnt, size.nodes_per_leaf)
+		node_cnt := size.leaf_cnt * size.nodes_per_leaf
+
+		b.Run(fmt.Sprintf("nodes=%d", node_cnt), func(b *testing.B) {
+			/* Three quarters of the nodes are available, the job wants a tenth */
+			avail := bit_alloc(node_cnt)
+			for i := 0; i < node_cnt*3/4; i++ {
+				bit_set(avail, rand.Intn(node_cnt))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				eval := &topology_eval_t{
+					node_map:  bit_copy(avail),
+					req_nodes: uint32(node_cnt / 10),
+				}
+				rc := topo.eval_nodes_tree(eval, false)
+				require.Equal(b, slurm.SUCCESS, rc)
+			}
+		})
+	}
+}
+
 func Test_eval_nodes_tree_topo3(t *testing.T) {
-	err := switch_record_validate("../../../../test/topology3.conf")
+	topo, err := Load("../../../../test/topology3.conf")
 	require.NoError(t, err)
 
-	node_map := &bitstr_t{"worker001", "worker002", "worker003", "worker004", "worker005", "worker006", "worker007"}
+	node_map := node_bitmap(t, topo, "worker001", "worker002", "worker003", "worker004", "worker005", "worker006", "worker007")
 	eval := &topology_eval_t{
 		node_map:  node_map,
 		req_nodes: 4,
 	}
-	rc := eval_nodes_tree(eval, false)
+	rc := topo.eval_nodes_tree(eval, false)
 	require.Equal(t, slurm.SUCCESS, rc)
-	require.Equal(t, &bitstr_t{"worker001", "worker002", "worker003", "worker004"}, eval.node_map)
+	require.Equal(t, []string{"worker001", "worker002", "worker003", "worker004"}, topo.bitmap2hostlist(eval.node_map))
 	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
 }
 
 func Test_eval_nodes_tree_topo2(t *testing.T) {
-	err := switch_record_validate("../../../../test/topology2.conf")
+	topo, err := Load("../../../../test/topology2.conf")
 	require.NoError(t, err)
 
-	node_map := &bitstr_t{"tux0", "tux1", "tux2", "tux12", "tux13", "tux14", "tux15"}
+	node_map := node_bitmap(t, topo, "tux0", "tux1", "tux2", "tux12", "tux13", "tux14", "tux15")
 	eval := &topology_eval_t{
 		node_map:  node_map,
 		req_nodes: 4,
 	}
-	rc := eval_nodes_tree(eval, false)
+	rc := topo.eval_nodes_tree(eval, false)
 	require.Equal(t, slurm.SUCCESS, rc)
-	require.Equal(t, &bitstr_t{"tux12", "tux13", "tux14", "tux15"}, eval.node_map)
+	require.Equal(t, []string{"tux12", "tux13", "tux14", "tux15"}, topo.bitmap2hostlist(eval.node_map))
 	require.Equal(t, uint16(1), eval.leaf_switch_cnt)
 }
 
 func Test_eval_nodes_tree_topo1(t *testing.T) {
-	err := switch_record_validate("../../../../test/topology1.conf")
+	topo, err := Load("../../../../test/topology1.conf")
 	require.NoError(t, err)
 
-	node_map := &bitstr_t{"tu-x1", "tu-x3", "tux5", "tux6", "tux7"}
+	node_map := node_bitmap(t, topo, "tu-x1", "tu-x3", "tux5", "tux6", "tux7")
 	eval := &topology_eval_t{
 		node_map:  node_map,
 		req_nodes: 3,
 	}
-	rc := eval_nodes_tree(eval, false)
+	rc := topo.eval_nodes_tree(eval, false)
 	require.Equal(t, slurm.SUCCESS, rc)
-	require.Equal(t, &bitstr_t{"tux5", "tux6", "tux7"}, eval.node_map)
+	require.Equal(t, []string{"tux5", "tux6", "tux7"}, topo.bitmap2hostlist(eval.node_map))
 	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
 
-	node_map = &bitstr_t{"tu-x1"}
+	node_map = node_bitmap(t, topo, "tu-x1")
 	eval = &topology_eval_t{
 		node_map:  node_map,
 		req_nodes: 3,
 	}
-	rc = eval_nodes_tree(eval, false)
+	rc = topo.eval_nodes_tree(eval, false)
 	require.Equal(t, slurm.ERROR, rc)
 
-	node_map = &bitstr_t{"tu-x0", "tu-x2", "tux4", "tux7"}
+	node_map = node_bitmap(t, topo, "tu-x0", "tu-x2", "tux4", "tux7")
 	eval = &topology_eval_t{
 		node_map:  node_map,
 		req_nodes: 3,
 	}
-	rc = eval_nodes_tree(eval, false)
+	rc = topo.eval_nodes_tree(eval, false)
 	require.Equal(t, slurm.SUCCESS, rc)
-	require.Equal(t, &bitstr_t{"tu-x0", "tu-x2", "tux4"}, eval.node_map)
+	require.Equal(t, []string{"tu-x0", "tu-x2", "tux4"}, topo.bitmap2hostlist(eval.node_map))
 	require.Equal(t, uint16(3), eval.leaf_switch_cnt)
 
 	// With req_node_bitmap
-	node_map = &bitstr_t{"tu-x0", "tu-x2", "tux4", "tux7"}
+	node_map = node_bitmap(t, topo, "tu-x0", "tu-x2", "tux4", "tux7")
 	eval = &topology_eval_t{
 		node_map:        node_map,
-		req_node_bitmap: &bitstr_t{"tu-x0", "tu-x2", "tux4"},
+		req_node_bitmap: node_bitmap(t, topo, "tu-x0", "tu-x2", "tux4"),
 		req_nodes:       3,
 	}
-	rc = eval_nodes_tree(eval, false)
+	rc = topo.eval_nodes_tree(eval, false)
 	require.Equal(t, slurm.SUCCESS, rc)
-	require.Equal(t, &bitstr_t{"tu-x0", "tu-x2", "tux4"}, eval.node_map)
+	require.Equal(t, []string{"tu-x0", "tu-x2", "tux4"}, topo.bitmap2hostlist(eval.node_map))
 	require.Equal(t, uint16(3), eval.leaf_switch_cnt)
 
-	node_map = &bitstr_t{"tu-x0", "tu-x1", "tu-x2", "tux4", "tux5", "tux6"}
+	node_map = node_bitmap(t, topo, "tu-x0", "tu-x1", "tu-x2", "tux4", "tux5", "tux6")
 	eval = &topology_eval_t{
 		node_map:        node_map,
-		req_node_bitmap: &bitstr_t{"tux4"},
+		req_node_bitmap: node_bitmap(t, topo, "tux4"),
+		req_nodes:       3,
+	}
+	rc = topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tux4", "tux5", "tux6"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+}
+
+func Test_eval_nodes_tree_stalled(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	/* tux5 is under s6 but no leaf switch can add it */
+	for i := 0; i < topo.switch_record_cnt; i++ {
+		if topo.switch_record_table[i].name == "s2" {
+			bit_clear(topo.switch_record_table[i].node_bitmap, topo._find_node_inx("tux5"))
+		}
+	}
+
+	trace := Trace{}
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, "tux4", "tux5"),
+		req_nodes: 2,
+		trace:     &trace,
+	}
+	rc := topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.ERROR, rc)
+	require.Equal(t, "insufficient resources currently available, no reachable leaf switch with nodes left", trace.StopReason)
+}
+
+func Test__build_node_weight_list(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf", WithNodeWeights(map[string]uint32{
+		"tu-x0": 5, "tu-x1": 1, "tu-x2": 5, "tu-x3": 3, "tux4": 0,
+	}))
+	require.NoError(t, err)
+
+	node_weight_list := topo._build_node_weight_list(node_bitmap(t, topo, "tu-x0", "tu-x1", "tu-x2", "tu-x3", "tux5"))
+	weights := []uint64{}
+	nodes := [][]string{}
+	for e := node_weight_list.Front(); e != nil; e = e.Next() {
+		nw := e.Value.(*topo_weight_info_t)
+		require.Equal(t, bit_set_count(nw.node_bitmap), nw.node_cnt)
+		weights = append(weights, nw.weight)
+		nodes = append(nodes, topo.bitmap2hostlist(nw.node_bitmap))
+	}
+	require.Equal(t, []uint64{1, 3, 5}, weights)
+	require.Equal(t, [][]string{{"tu-x1", "tux5"}, {"tu-x3"}, {"tu-x0", "tu-x2"}}, nodes)
+}
+
+func Test_eval_nodes_tree_weights(t *testing.T) {
+	/* Keep jobs off the large memory nodes */
+	topo, err := Load("../../../../test/topology1.conf", WithNodeWeights(map[string]uint32{
+		"tu-x0": 10, "tu-x1": 10,
+	}))
+	require.NoError(t, err)
+
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 2,
+	}
+	rc := topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x2", "tu-x3"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(1), eval.leaf_switch_cnt)
+
+	/* All low weight nodes are used before any higher weight node */
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 7,
+	}
+	rc = topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x0", "tu-x2", "tu-x3", "tux4", "tux5", "tux6", "tux7"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(4), eval.leaf_switch_cnt)
+
+	/* Weight is preferred over leaf switch count */
+	topo, err = Load("../../../../test/topology1.conf", WithNodeWeights(map[string]uint32{
+		"tux4": 5, "tux5": 5, "tux6": 5, "tux7": 5,
+	}))
+	require.NoError(t, err)
+	node_map := node_bitmap(t, topo, "tu-x0", "tu-x2", "tux4", "tux5", "tux6", "tux7")
+	eval = &topology_eval_t{
+		node_map:  bit_copy(node_map),
+		req_nodes: 2,
+	}
+	rc = topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x0", "tu-x2"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+
+	eval = &topology_eval_t{
+		node_map:  bit_copy(node_map),
+		req_nodes: 2,
+	}
+	rc = topo.eval_nodes_tree(eval, true)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x0", "tu-x2"}, topo.bitmap2hostlist(eval.node_map))
+
+	/* Without weights, one leaf switch is enough */
+	topo, err = Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+	eval = &topology_eval_t{
+		node_map:  bit_copy(node_map),
+		req_nodes: 2,
+	}
+	rc = topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tux4", "tux5"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(1), eval.leaf_switch_cnt)
+}
+
+func Test_eval_nodes_tree_required_leaf_switches(t *testing.T) {
+	/*
+	 * The lowest weight nodes are added as required nodes, their leaf
+	 * switch has no nodes left to offer to the leaf switch loop
+	 */
+	topo, err := Load("../../../../test/topology1.conf", WithNodeWeights(map[string]uint32{
+		"tu-x0": 1, "tu-x1": 1, "tu-x2": 5, "tu-x3": 5, "tux4": 5, "tux5": 5, "tux6": 5, "tux7": 5,
+	}))
+	require.NoError(t, err)
+
+	trace := Trace{}
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 3,
+		trace:     &trace,
+	}
+	rc := topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x0", "tu-x1", "tu-x2"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+	require.Equal(t, "request satisfied from leaf switch s1", trace.StopReason)
+	for _, step := range trace.Steps {
+		require.Equal(t, "s1", step.Chosen)
+	}
+}
+
+func Test_eval_nodes_tree_dfly(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	/* The job fits on one leaf switch */
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 2,
+	}
+	rc := topo.eval_nodes_tree(eval, true)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x0", "tu-x1"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(1), eval.leaf_switch_cnt)
+
+	/* Fill the first leaf switch, then one node per leaf switch */
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, topo.Nodes()...),
+		req_nodes: 5,
+	}
+	rc = topo.eval_nodes_tree(eval, true)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x0", "tu-x1", "tu-x2", "tux4", "tux6"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(4), eval.leaf_switch_cnt)
+
+	/* Start from the leaf switch with the most available nodes */
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, "tu-x1", "tu-x3", "tux5", "tux6", "tux7"),
+		req_nodes: 3,
+	}
+	rc = topo.eval_nodes_tree(eval, true)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"tu-x1", "tux6", "tux7"}, topo.bitmap2hostlist(eval.node_map))
+	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+
+	// With req_node_bitmap
+	eval = &topology_eval_t{
+		node_map:        node_bitmap(t, topo, "tu-x0", "tu-x1", "tux4", "tux5"),
+		req_node_bitmap: node_bitmap(t, topo, "tux4"),
 		req_nodes:       3,
 	}
-	rc = eval_nodes_tree(eval, false)
+	rc = topo.eval_nodes_tree(eval, true)
 	require.Equal(t, slurm.SUCCESS, rc)
-	require.Equal(t, &bitstr_t{"tux4", "tux5", "tux6"}, eval.node_map)
+	require.Equal(t, []string{"tu-x0", "tux4", "tux5"}, topo.bitmap2hostlist(eval.node_map))
 	require.Equal(t, uint16(2), eval.leaf_switch_cnt)
+
+	eval = &topology_eval_t{
+		node_map:  node_bitmap(t, topo, "tu-x1"),
+		req_nodes: 3,
+	}
+	rc = topo.eval_nodes_tree(eval, true)
+	require.Equal(t, slurm.ERROR, rc)
+}
+
+func Test_eval_nodes_tree_synthetic(t *testing.T) {
+	topo := _synthetic_topology(t, 125, 32)
+	require.Equal(t, 4000, topo.node_record_cnt)
+
+	/* Every other node is available, so 40 nodes need three leaf switches */
+	node_map := bit_alloc(topo.node_record_cnt)
+	for i := 0; i < topo.node_record_cnt; i += 2 {
+		bit_set(node_map, i)
+	}
+	eval := &topology_eval_t{
+		node_map:  node_map,
+		req_nodes: 40,
+	}
+	rc := topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, 40, bit_set_count(eval.node_map))
+	require.Equal(t, uint16(3), eval.leaf_switch_cnt)
+}
+
+func Test_eval_nodes_tree_natural_order(t *testing.T) {
+	topo, err := Load(_write_topo_file(t,
+		"SwitchName=s0 Nodes=gpu[9-10],cpu[10-11]\n"+
+			"SwitchName=s1 Nodes=cpu[1-2],cpu9\n"+
+			"SwitchName=s2 Switches=s[0-1]\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu1", "cpu2", "cpu9", "cpu10", "cpu11", "gpu9", "gpu10"}, topo.Nodes())
+
+	/* Nodes are taken from a switch in natural order, whatever the prefix */
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, "gpu10", "gpu9", "cpu11", "cpu10"),
+		req_nodes: 3,
+	}
+	rc := topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"cpu10", "cpu11", "gpu9"}, topo.bitmap2hostlist(eval.node_map))
+}
+
+func Test_eval_nodes_tree_node_order(t *testing.T) {
+	conf := _write_topo_file(t,
+		"SwitchName=s0 Nodes=gpu[9-10],cpu[10-11]\n"+
+			"SwitchName=s1 Nodes=cpu[1-2],cpu9\n"+
+			"SwitchName=s2 Switches=s[0-1]\n")
+	topo, err := Load(conf, WithNodeOrder([]string{"gpu10", "gpu9", "cpu11", "cpu10", "cpu2"}))
+	require.NoError(t, err)
+	require.Equal(t, []string{"gpu10", "gpu9", "cpu11", "cpu10", "cpu2", "cpu1", "cpu9"}, topo.Nodes())
+
+	/* Nodes are taken from a switch in slurm.conf order */
+	eval := &topology_eval_t{
+		node_map:  node_bitmap(t, topo, "gpu10", "gpu9", "cpu11", "cpu10"),
+		req_nodes: 3,
+	}
+	rc := topo.eval_nodes_tree(eval, false)
+	require.Equal(t, slurm.SUCCESS, rc)
+	require.Equal(t, []string{"gpu10", "gpu9", "cpu11"}, topo.bitmap2hostlist(eval.node_map))
 }
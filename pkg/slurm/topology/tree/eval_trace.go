@@ -0,0 +1,131 @@
+package tree
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Trace records the decisions of an evaluation, see WithTrace.
+type Trace struct {
+	// TopSwitch is the switch the allocation is built under, empty if none
+	// was chosen.
+	TopSwitch string `json:"top_switch,omitempty"`
+	// TopSwitchReason tells why TopSwitch was chosen.
+	TopSwitchReason string `json:"top_switch_reason,omitempty"`
+	// Steps are the rounds choosing a leaf switch to add nodes from, in order.
+	Steps []TraceStep `json:"steps,omitempty"`
+	// StopReason tells why the evaluation stopped, successfully or not.
+	StopReason string `json:"stop_reason"`
+}
+
+// TraceStep is a round of the evaluation choosing the best leaf switch to
+// add nodes from.
+type TraceStep struct {
+	// RemainingNodes is the number of nodes still needed by the request.
+	RemainingNodes int `json:"remaining_nodes"`
+	// Candidates are the leaf switches considered, in switch order.
+	Candidates []TraceCandidate `json:"candidates"`
+	// Chosen is the leaf switch nodes are added from, empty if none fits.
+	Chosen string `json:"chosen,omitempty"`
+}
+
+// TraceCandidate is a leaf switch considered by a TraceStep.
+type TraceCandidate struct {
+	// Switch is the name of the leaf switch.
+	Switch string `json:"switch"`
+	// Distance is the sum of the distances in links from the switch to the
+	// switches already used. It is meaningless if Unreachable is set.
+	Distance uint32 `json:"distance"`
+	// Unreachable is set if the switch is not connected to a switch used.
+	Unreachable bool `json:"unreachable,omitempty"`
+	// NodeCount is the number of nodes the switch can add.
+	NodeCount int `json:"node_count"`
+	// Best is the best candidate the switch is compared with, empty if it is
+	// the first possibility.
+	Best string `json:"best,omitempty"`
+	// Fit is 1 if the switch fits the request better than Best, -1 if it
+	// fits worse and 0 if it fits as well, see _topo_compare_switches.
+	Fit int `json:"fit"`
+	// Preferred is set if the switch became the best candidate.
+	Preferred bool `json:"preferred,omitempty"`
+}
+
+type eval_options_t struct {
+	trace *Trace
+}
+
+// EvalOption configures how nodes are evaluated.
+type EvalOption func(*eval_options_t)
+
+// WithTrace makes Eval record its decisions into trace, which is reset first.
+// The trace is recorded even if the evaluation fails. Candidate leaf switches
+// are only recorded by the topology/tree evaluator without dragonfly.
+func WithTrace(trace *Trace) EvalOption {
+	return func(o *eval_options_t) {
+		o.trace = trace
+	}
+}
+
+/* Log an evaluation error and record it as the reason to stop */
+func (topo_eval *topology_eval_t) _error(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Error(msg)
+	topo_eval._trace_stop(msg)
+}
+
+/* Record why the evaluation stopped, if tracing */
+func (topo_eval *topology_eval_t) _trace_stop(format string, args ...any) {
+	if topo_eval.trace == nil {
+		return
+	}
+	topo_eval.trace.StopReason = fmt.Sprintf(format, args...)
+}
+
+/*
+ * Record why the top switch inx was chosen, if tracing: it is the highest
+ * level switch with required nodes or with rem_nodes nodes of the lowest
+ * weight.
+ */
+func (t *Topology) _trace_top_switch(topo_eval *topology_eval_t, inx int, required bool, rem_nodes int, weight uint64) {
+	if topo_eval.trace == nil {
+		return
+	}
+	topo_eval.trace.TopSwitch = t.switch_record_table[inx].name
+	if required {
+		topo_eval.trace.TopSwitchReason = "highest level switch with required nodes"
+	} else {
+		topo_eval.trace.TopSwitchReason = fmt.Sprintf(
+			"highest level switch with %d or more available nodes of the lowest weight %d",
+			rem_nodes, weight)
+	}
+}
+
+/* Start a round choosing a leaf switch, nil if not tracing */
+func (topo_eval *topology_eval_t) _trace_step(rem_nodes int) *TraceStep {
+	if topo_eval.trace == nil {
+		return nil
+	}
+	topo_eval.trace.Steps = append(topo_eval.trace.Steps, TraceStep{
+		RemainingNodes: rem_nodes,
+		Candidates:     []TraceCandidate{},
+	})
+	return &topo_eval.trace.Steps[len(topo_eval.trace.Steps)-1]
+}
+
+/* Record leaf switch i into step, return the candidate or nil if not tracing */
+func (t *Topology) _trace_candidate(step *TraceStep, dist *[]uint32, switch_node_cnt *[]int, i int) *TraceCandidate {
+	if step == nil {
+		return nil
+	}
+	candidate := TraceCandidate{
+		Switch:      t.switch_record_table[i].name,
+		Unreachable: (*dist)[i] == INFINITE,
+		NodeCount:   (*switch_node_cnt)[i],
+	}
+	if !candidate.Unreachable {
+		candidate.Distance = (*dist)[i]
+	}
+	step.Candidates = append(step.Candidates, candidate)
+	return &step.Candidates[len(step.Candidates)-1]
+}
@@ -0,0 +1,179 @@
+package tree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+/* Weight of nodes without a Weight= setting, as in slurm.conf */
+const DEFAULT_NODE_WEIGHT = 1
+
+/*
+ * _walk_slurm_conf calls fn with the key-value pairs of the lines of a
+ * slurm.conf style file, and of the files it includes, whose first key is
+ * key. Other lines are ignored.
+ */
+func _walk_slurm_conf(filename string, key string, depth int, fn func(pairs []key_value_t, filename string, line int) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return &ConfigError{File: filename, Err: err}
+	}
+	defer f.Close()
+
+	lines, err := _read_config_lines(f)
+	if err != nil {
+		return &ConfigError{File: filename, Err: err}
+	}
+	for _, l := range lines {
+		if path, ok := _include_path(l.text); ok {
+			if depth >= MAX_INCLUDE_DEPTH {
+				return &ConfigError{File: filename, Line: l.line,
+					Err: fmt.Errorf("%w: Include nested more than %d deep", ErrSyntax, MAX_INCLUDE_DEPTH)}
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			if err := _walk_slurm_conf(path, key, depth+1, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasPrefix(strings.ToLower(l.text), strings.ToLower(key)) {
+			continue
+		}
+
+		pairs, err := _parse_keyvalues(l.text)
+		if err != nil {
+			return &ConfigError{File: filename, Line: l.line, Err: fmt.Errorf("%w: %v", ErrSyntax, err)}
+		}
+		if !strings.EqualFold(pairs[0].key, key) {
+			continue
+		}
+		if err := fn(pairs, filename, l.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * _read_node_weights reads the Weight= of the NodeName lines of a slurm.conf
+ * style file into weights. NodeName=DEFAULT sets the weight of the nodes
+ * defined by the following lines.
+ */
+func _read_node_weights(filename string, weights map[string]uint32, default_weight *uint32) error {
+	return _walk_slurm_conf(filename, "NodeName", 0, func(pairs []key_value_t, filename string, line int) error {
+		weight := *default_weight
+		for _, pair := range pairs[1:] {
+			if !strings.EqualFold(pair.key, "Weight") {
+				continue
+			}
+			value, err := strconv.ParseUint(pair.value, 10, 32)
+			if err != nil {
+				return &ConfigError{File: filename, Line: line,
+					Err: fmt.Errorf("%w: %s", ErrInvalidWeight, pair.value)}
+			}
+			weight = uint32(value)
+		}
+
+		if strings.EqualFold(pairs[0].value, "DEFAULT") {
+			*default_weight = weight
+			return nil
+		}
+		names, err := hostlist.Expand(pairs[0].value)
+		if err != nil {
+			return &ConfigError{File: filename, Line: line, Err: fmt.Errorf("invalid node name: %w", err)}
+		}
+		for _, name := range names {
+			weights[name] = weight
+		}
+		return nil
+	})
+}
+
+// LoadNodeWeights reads the scheduling weights of nodes from the NodeName
+// lines of a slurm.conf file, for use with WithNodeWeights. Nodes without a
+// Weight= setting get the default weight of 1.
+func LoadNodeWeights(filename string) (map[string]uint32, error) {
+	weights := map[string]uint32{}
+	default_weight := uint32(DEFAULT_NODE_WEIGHT)
+	if err := _read_node_weights(filename, weights, &default_weight); err != nil {
+		return nil, err
+	}
+	return weights, nil
+}
+
+// LoadNodeOrder reads the names of the nodes of the NodeName lines of a
+// slurm.conf file in definition order, the order of the node table of
+// slurmctld, for use with WithNodeOrder.
+func LoadNodeOrder(filename string) ([]string, error) {
+	order := []string{}
+	known := map[string]bool{}
+	err := _walk_slurm_conf(filename, "NodeName", 0, func(pairs []key_value_t, filename string, line int) error {
+		if strings.EqualFold(pairs[0].value, "DEFAULT") {
+			return nil
+		}
+		names, err := hostlist.Expand(pairs[0].value)
+		if err != nil {
+			return &ConfigError{File: filename, Line: line, Err: fmt.Errorf("invalid node name: %w", err)}
+		}
+		for _, name := range names {
+			if !known[name] {
+				known[name] = true
+				order = append(order, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+/* Set the scheduling weights of the known nodes */
+func (t *Topology) _set_node_weights(weights map[string]uint32) {
+	for name, weight := range weights {
+		inx := t._find_node_inx(name)
+		if inx < 0 {
+			log.Debugf("Ignoring weight of node %s, not in topology", name)
+			continue
+		}
+		t.node_record_table[inx].weight = weight
+	}
+}
+
+// LoadPartitionTopologies reads the Topology= of the PartitionName lines of a
+// slurm.conf file, by partition name. Partitions without a Topology= setting
+// use the cluster default topology and are mapped to an empty name.
+// PartitionName=DEFAULT sets the topology of the partitions defined by the
+// following lines.
+func LoadPartitionTopologies(filename string) (map[string]string, error) {
+	partitions := map[string]string{}
+	default_topology := ""
+	err := _walk_slurm_conf(filename, "PartitionName", 0, func(pairs []key_value_t, filename string, line int) error {
+		topology := default_topology
+		for _, pair := range pairs[1:] {
+			if strings.EqualFold(pair.key, "Topology") {
+				topology = pair.value
+			}
+		}
+		if strings.EqualFold(pairs[0].value, "DEFAULT") {
+			default_topology = topology
+			return nil
+		}
+		partitions[pairs[0].value] = topology
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return partitions, nil
+}
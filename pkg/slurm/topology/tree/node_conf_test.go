@@ -0,0 +1,67 @@
+package tree
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadNodeWeights(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "slurm.conf")
+	require.NoError(t, os.WriteFile(filename, []byte(`ClusterName=test
+NodeName=DEFAULT CPUs=4 Weight=5
+NodeName=tux[0-1] RealMemory=1024
+nodename=tux2 weight=100 # large memory
+Include gpu.conf
+PartitionName=debug Nodes=ALL Default=YES
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gpu.conf"), []byte(
+		"NodeName=DEFAULT Weight=1\nNodeName=gpu[1-2] Gres=gpu:8 Weight=50\nNodeName=tux3\n"), 0644))
+
+	weights, err := LoadNodeWeights(filename)
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint32{
+		"tux0": 5, "tux1": 5, "tux2": 100, "gpu1": 50, "gpu2": 50, "tux3": 1,
+	}, weights)
+
+	require.NoError(t, os.WriteFile(filename, []byte("\nNodeName=tux0 Weight=heavy\n"), 0644))
+	_, err = LoadNodeWeights(filename)
+	require.ErrorIs(t, err, ErrInvalidWeight)
+	require.EqualError(t, err, filename+":2: invalid Weight: heavy")
+
+	_, err = LoadNodeWeights(filepath.Join(dir, "missing.conf"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestLoadPartitionTopologies(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "slurm.conf")
+	require.NoError(t, os.WriteFile(filename, []byte(`PartitionName=debug Nodes=ALL Default=YES
+PartitionName=DEFAULT Topology=gpu
+partitionname=gpu Nodes=gpu[1-8]
+PartitionName=cpu Nodes=tux[0-15] Topology=cpu
+`), 0644))
+
+	partitions, err := LoadPartitionTopologies(filename)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"debug": "", "gpu": "gpu", "cpu": "cpu"}, partitions)
+}
+
+func TestLoadNodeOrder(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "slurm.conf")
+	require.NoError(t, os.WriteFile(filename, []byte(`NodeName=DEFAULT CPUs=4
+NodeName=tux[8-11]
+Include gpu.conf
+NodeName=tux[0-7],tux8
+`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "gpu.conf"), []byte("NodeName=gpu[1-2] Gres=gpu:8\n"), 0644))
+
+	order, err := LoadNodeOrder(filename)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux8", "tux9", "tux10", "tux11", "gpu1", "gpu2",
+		"tux0", "tux1", "tux2", "tux3", "tux4", "tux5", "tux6", "tux7"}, order)
+}
@@ -0,0 +1,149 @@
+package tree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+/* Maximum nesting of Include directives */
+const MAX_INCLUDE_DEPTH = 16
+
+type config_line_t struct {
+	line int    /* number of the first physical line */
+	text string /* logical line, without comments and continuations */
+}
+
+type key_value_t struct {
+	key   string
+	value string
+}
+
+/*
+ * _strip_comments removes everything from the first unescaped '#' and
+ * unescapes "\#", as Slurm's config parser does.
+ */
+func _strip_comments(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' && i+1 < len(line) && line[i+1] == '#' {
+			b.WriteByte('#')
+			i++
+			continue
+		}
+		if line[i] == '#' {
+			break
+		}
+		b.WriteByte(line[i])
+	}
+	return b.String()
+}
+
+/*
+ * _read_config_lines reads the logical lines of a configuration file.
+ * Comments are removed, lines ending with a backslash are joined with the
+ * next line and blank lines are skipped. As in Slurm, the text around the
+ * backslash is joined without a separator, so a line can be continued in
+ * the middle of a value.
+ */
+func _read_config_lines(r io.Reader) ([]config_line_t, error) {
+	lines := []config_line_t{}
+
+	s := bufio.NewScanner(r)
+	line := 0
+	var cur *config_line_t
+	for s.Scan() {
+		line++
+		txt := strings.TrimRightFunc(_strip_comments(s.Text()), unicode.IsSpace)
+		continued := strings.HasSuffix(txt, "\\")
+		txt = strings.TrimSuffix(txt, "\\")
+
+		if cur == nil {
+			cur = &config_line_t{line: line}
+		}
+		cur.text += txt
+		if continued {
+			continue
+		}
+
+		if strings.TrimSpace(cur.text) != "" {
+			cur.text = strings.TrimSpace(cur.text)
+			lines = append(lines, *cur)
+		}
+		cur = nil
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil && strings.TrimSpace(cur.text) != "" {
+		cur.text = strings.TrimSpace(cur.text)
+		lines = append(lines, *cur)
+	}
+	return lines, nil
+}
+
+/* Return the file named by an "Include <file>" line, if it is one */
+func _include_path(text string) (string, bool) {
+	i := strings.IndexFunc(text, unicode.IsSpace)
+	if i < 0 || !strings.EqualFold(text[:i], "Include") {
+		return "", false
+	}
+	path := strings.Trim(strings.TrimSpace(text[i:]), "\"")
+	return path, path != ""
+}
+
+func _is_key_char(c byte) bool {
+	return c == '_' || c == '.' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func _skip_space(text string, i int) int {
+	for i < len(text) && (text[i] == ' ' || text[i] == '\t') {
+		i++
+	}
+	return i
+}
+
+/*
+ * _parse_keyvalues splits a logical line into "Key=Value" pairs. Whitespace
+ * is allowed around '=' and values may be double quoted to include spaces.
+ */
+func _parse_keyvalues(text string) ([]key_value_t, error) {
+	pairs := []key_value_t{}
+	for i := _skip_space(text, 0); i < len(text); i = _skip_space(text, i) {
+		start := i
+		for i < len(text) && _is_key_char(text[i]) {
+			i++
+		}
+		key := text[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("unexpected %q", text[start:])
+		}
+
+		i = _skip_space(text, i)
+		if i >= len(text) || text[i] != '=' {
+			return nil, fmt.Errorf("missing value for key %s", key)
+		}
+		i = _skip_space(text, i+1)
+
+		value := ""
+		if i < len(text) && text[i] == '"' {
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in value of key %s", key)
+			}
+			value = text[i+1 : i+1+end]
+			i += end + 2
+		} else {
+			start = i
+			for i < len(text) && text[i] != ' ' && text[i] != '\t' {
+				i++
+			}
+			value = text[start:i]
+		}
+		pairs = append(pairs, key_value_t{key: key, value: value})
+	}
+	return pairs, nil
+}
@@ -0,0 +1,75 @@
+package tree
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test__strip_comments(t *testing.T) {
+	require.Equal(t, "", _strip_comments("# comment"))
+	require.Equal(t, "SwitchName=s0 ", _strip_comments("SwitchName=s0 # comment"))
+	require.Equal(t, "SwitchName=s#0 ", _strip_comments("SwitchName=s\\#0 # comment"))
+	require.Equal(t, "SwitchName=s0", _strip_comments("SwitchName=s0"))
+}
+
+func Test__read_config_lines(t *testing.T) {
+	lines, err := _read_config_lines(strings.NewReader(`# topology.conf
+
+SwitchName=s0	Nodes=tux[0-3]   # inline comment
+SwitchName=s1 \
+    Nodes=tux[4-7] \
+    LinkSpeed=900
+  # indented comment
+SwitchName=s2 Nodes=tux[0-3],\
+tux[4-7]
+SwitchName=s3 Switches=s[0-2] \
+`))
+	require.NoError(t, err)
+	require.Equal(t, []config_line_t{
+		{line: 3, text: "SwitchName=s0\tNodes=tux[0-3]"},
+		{line: 4, text: "SwitchName=s1     Nodes=tux[4-7]     LinkSpeed=900"},
+		{line: 8, text: "SwitchName=s2 Nodes=tux[0-3],tux[4-7]"},
+		{line: 10, text: "SwitchName=s3 Switches=s[0-2]"},
+	}, lines)
+
+	/* A value continued on the next line is one value */
+	topo, err := LoadReader(strings.NewReader("SwitchName=s0 Nodes=tux[0-3],\\\ntux[4-7]\n"), "inline.conf", WithStrict())
+	require.NoError(t, err)
+	require.Len(t, topo.Nodes(), 8)
+}
+
+func Test__include_path(t *testing.T) {
+	path, ok := _include_path("Include leaves.conf")
+	require.True(t, ok)
+	require.Equal(t, "leaves.conf", path)
+
+	path, ok = _include_path("include\t\"/etc/slurm/topology.d/spines.conf\"")
+	require.True(t, ok)
+	require.Equal(t, "/etc/slurm/topology.d/spines.conf", path)
+
+	_, ok = _include_path("Include")
+	require.False(t, ok)
+	_, ok = _include_path("SwitchName=s0 Nodes=tux0")
+	require.False(t, ok)
+}
+
+func Test__parse_keyvalues(t *testing.T) {
+	pairs, err := _parse_keyvalues("switchname=s0  NODES = tux[0-3]\tLinkSpeed= 900 Extra=\"a b\" Empty=")
+	require.NoError(t, err)
+	require.Equal(t, []key_value_t{
+		{key: "switchname", value: "s0"},
+		{key: "NODES", value: "tux[0-3]"},
+		{key: "LinkSpeed", value: "900"},
+		{key: "Extra", value: "a b"},
+		{key: "Empty", value: ""},
+	}, pairs)
+
+	_, err = _parse_keyvalues("SwitchName s0")
+	require.Error(t, err)
+	_, err = _parse_keyvalues("SwitchName=s0 =tux0")
+	require.Error(t, err)
+	_, err = _parse_keyvalues("SwitchName=\"s0")
+	require.Error(t, err)
+}
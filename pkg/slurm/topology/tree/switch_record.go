@@ -1,28 +1,24 @@
 package tree
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
-	"regexp"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
 )
 
 const INFINITE = 0xffffffff
 
-var (
-	switch_record_table = make([]*switch_record_t, 0)
-	switch_record_cnt   = 0
-
-	node_record_table = make([]*node_record_t, 0)
-	node_record_cnt   = 0
-)
-
 type node_record_t struct {
-	name string /* name of the node. NULL==defunct */
+	name   string /* name of the node. NULL==defunct */
+	weight uint32 /* weight for scheduling, lower is preferred */
 
 	/* Hilbert number based on node name,
 	 * or other sequence number used to
@@ -36,6 +32,16 @@ type slurm_conf_switches_t struct {
 	nodes       string /* names of nodes directly connect to this switch, if any */
 	switch_name string /* name of this switch */
 	switches    string /* names if child switches directly connected to this switch, if any */
+	file        string /* configuration file defining this switch */
+	line        int    /* line number in file */
+}
+
+/* Records of a topology configuration, by plugin */
+type topology_conf_t struct {
+	file        string                   /* top-level configuration file */
+	switches    []*slurm_conf_switches_t /* SwitchName lines, for topology/tree */
+	blocks      []*slurm_conf_block_t    /* BlockName lines, for topology/block */
+	block_sizes *slurm_conf_block_sizes_t
 }
 
 type switch_record_t struct {
@@ -47,85 +53,161 @@ type switch_record_t struct {
 	num_desc_switches uint16    /* number of descendant switches */
 	num_switches      uint16    /* number of direct descendant switches */
 	parent            uint16    /* index of parent switch */
-	switch_bitmap     *bitstr_t /* XXX: bitmap of all switches descended from this switch */
+	switch_names      []string  /* names of direct descendant switches */
 	switches          string    /* name of direct descendant switches */
 	switches_dist     []uint32  /* distance to other switches */
 	switch_desc_index []uint16  /* indexes of child descendant switches */
 	switch_index      []uint16  /* indexes of child direct descendant switches */
+	file              string    /* configuration file defining this switch */
+	line              int       /* line number in file */
+}
+
+/*
+ * _diag records a configuration problem that does not prevent loading the
+ * topology. The offending setting or line is skipped.
+ */
+func (t *Topology) _diag(diag *ConfigError) {
+	log.Warn(diag)
+	t.diagnostics = append(t.diagnostics, diag)
 }
 
-func _parse_switches(f *os.File) ([]*slurm_conf_switches_t, error) {
-	list := []*slurm_conf_switches_t{}
-
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		txt := s.Text()
-		if !strings.HasPrefix(txt, "#") && strings.TrimSpace(txt) != "" {
-			table := strings.Split(txt, " ")
-
-			switches := &slurm_conf_switches_t{}
-
-			for _, column := range table {
-				pair := strings.Split(column, "=")
-
-				switch pair[0] {
-				case "LinkSpeed":
-					linkSpeed, err := strconv.ParseUint(pair[1], 10, 32)
-					if err != nil {
-						log.Errorf("Failed to parse LinkSpeed: %s", pair[1])
-						continue
-					}
-					switches.link_speed = uint32(linkSpeed)
-				case "SwitchName":
-					switches.switch_name = pair[1]
-				case "Nodes":
-					switches.nodes = pair[1]
-				case "Switches":
-					switches.switches = pair[1]
+/*
+ * _parse_topo_conf parses the switch and block lines of a configuration read
+ * from r. included holds the files that include filename, to resolve Include
+ * directives relative to filename and stop runaway recursion.
+ */
+func (t *Topology) _parse_topo_conf(r io.Reader, filename string, included []string) (*topology_conf_t, error) {
+	conf := &topology_conf_t{file: filename}
+
+	lines, err := _read_config_lines(r)
+	if err != nil {
+		return nil, &ConfigError{File: filename, Err: err}
+	}
+	for _, l := range lines {
+		if path, ok := _include_path(l.text); ok {
+			if len(included) >= MAX_INCLUDE_DEPTH {
+				return nil, &ConfigError{File: filename, Line: l.line,
+					Err: fmt.Errorf("%w: Include nested more than %d deep", ErrSyntax, MAX_INCLUDE_DEPTH)}
+			}
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			matches, err := filepath.Glob(path)
+			if err != nil || len(matches) == 0 {
+				/* Report the error of opening the file itself */
+				matches = []string{path}
+			}
+			for _, match := range matches {
+				sub_conf, err := t._read_topo_file(match, append(included, filename))
+				if err != nil {
+					return nil, err
+				}
+				conf.switches = append(conf.switches, sub_conf.switches...)
+				conf.blocks = append(conf.blocks, sub_conf.blocks...)
+				if sub_conf.block_sizes != nil {
+					conf.block_sizes = sub_conf.block_sizes
 				}
 			}
-			if len(switches.nodes) > 0 && len(switches.switches) > 0 {
-				log.Errorf("switch %s has both child switches and nodes", switches.switch_name)
-				continue
+			continue
+		}
+
+		pairs, err := _parse_keyvalues(l.text)
+		if err != nil {
+			return nil, &ConfigError{File: filename, Line: l.line, Err: fmt.Errorf("%w: %v", ErrSyntax, err)}
+		}
+
+		/* The first key of a line tells the kind of record */
+		switch strings.ToLower(pairs[0].key) {
+		case "blockname":
+			if block := t._parse_block(pairs, filename, l.line); block != nil {
+				conf.blocks = append(conf.blocks, block)
+			}
+			continue
+		case "blocksizes":
+			if block_sizes := t._parse_block_sizes(pairs, filename, l.line); block_sizes != nil {
+				conf.block_sizes = block_sizes
 			}
+			continue
+		}
 
-			if len(switches.nodes) == 0 && len(switches.switches) == 0 {
-				log.Errorf("switch %s has neither child switches nor nodes", switches.switch_name)
-				continue
+		switches := &slurm_conf_switches_t{
+			file: filename,
+			line: l.line,
+		}
+		for _, pair := range pairs {
+			if strings.EqualFold(pair.key, "SwitchName") {
+				switches.switch_name = pair.value
 			}
+		}
+
+		for _, pair := range pairs {
+			switch strings.ToLower(pair.key) {
+			case "linkspeed":
+				linkSpeed, err := strconv.ParseUint(pair.value, 10, 32)
+				if err != nil {
+					t._diag(&ConfigError{File: filename, Line: l.line, Switch: switches.switch_name,
+						Err: fmt.Errorf("%w: %s", ErrInvalidLinkSpeed, pair.value)})
+					continue
+				}
+				switches.link_speed = uint32(linkSpeed)
+			case "switchname":
+				/* Parsed above, for use in diagnostics */
+			case "nodes":
+				switches.nodes = pair.value
+			case "switches":
+				switches.switches = pair.value
+			default:
+				t._diag(&ConfigError{File: filename, Line: l.line, Switch: switches.switch_name,
+					Err: fmt.Errorf("%w: %s", ErrUnknownKey, pair.key)})
+			}
+		}
+		if len(switches.switch_name) == 0 {
+			return nil, &ConfigError{File: filename, Line: l.line, Err: fmt.Errorf("%w: missing SwitchName", ErrSyntax)}
+		}
+
+		if len(switches.nodes) > 0 && len(switches.switches) > 0 {
+			t._diag(&ConfigError{File: filename, Line: l.line, Switch: switches.switch_name,
+				Err: ErrMixedChildren})
+			continue
+		}
 
-			list = append(list, switches)
+		if len(switches.nodes) == 0 && len(switches.switches) == 0 {
+			t._diag(&ConfigError{File: filename, Line: l.line, Switch: switches.switch_name,
+				Err: ErrNoChildren})
+			continue
 		}
+
+		conf.switches = append(conf.switches, switches)
 	}
-	return list, nil
+	return conf, nil
 }
 
-func _read_topo_file(filename string) ([]*slurm_conf_switches_t, error) {
+func (t *Topology) _read_topo_file(filename string, included []string) (*topology_conf_t, error) {
 	f, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("Failed to open the %s file", filename)
+		return nil, &ConfigError{File: filename, Err: err}
 	}
 	defer f.Close()
 
 	log.Tracef("Reading the %s file", filename)
 
-	return _parse_switches(f)
+	return t._parse_topo_conf(f, filename, included)
 }
 
 /*
  * _find_child_switches creates an array of indexes to the
  * immediate descendants of switch sw.
  */
-func _find_child_switches(sw int) {
-	switch_record_table[sw].num_switches = uint16(bit_set_count(switch_record_table[sw].switch_bitmap))
-	switch_record_table[sw].switch_index = make([]uint16, switch_record_table[sw].num_switches)
+func (t *Topology) _find_child_switches(sw int) {
+	t.switch_record_table[sw].num_switches = uint16(len(t.switch_record_table[sw].switch_names))
+	t.switch_record_table[sw].switch_index = make([]uint16, t.switch_record_table[sw].num_switches)
 
 	cldx := 0
-	for _, swname := range *switch_record_table[sw].switch_bitmap {
-		for i := 0; i < switch_record_cnt; i++ {
-			if swname == switch_record_table[i].name {
-				switch_record_table[sw].switch_index[cldx] = uint16(i)
-				switch_record_table[i].parent = uint16(sw)
+	for _, swname := range t.switch_record_table[sw].switch_names {
+		for i := 0; i < t.switch_record_cnt; i++ {
+			if swname == t.switch_record_table[i].name {
+				t.switch_record_table[sw].switch_index[cldx] = uint16(i)
+				t.switch_record_table[i].parent = uint16(sw)
 				cldx++
 				break
 			}
@@ -137,21 +219,21 @@ func _find_child_switches(sw int) {
  * _find_desc_switches creates an array of indexes to the
  * all descendants of switch sw.
  */
-func _find_desc_switches(sw int) {
+func (t *Topology) _find_desc_switches(sw int) {
 	switchDescIndex := _merge_switches_array(
-		switch_record_table[sw].switch_desc_index,
-		switch_record_table[sw].switch_index)
-	switch_record_table[sw].switch_desc_index = switchDescIndex
-	switch_record_table[sw].num_desc_switches = uint16(len(switchDescIndex))
+		t.switch_record_table[sw].switch_desc_index,
+		t.switch_record_table[sw].switch_index)
+	t.switch_record_table[sw].switch_desc_index = switchDescIndex
+	t.switch_record_table[sw].num_desc_switches = uint16(len(switchDescIndex))
 
-	for k := uint16(0); k < switch_record_table[sw].num_switches; k++ {
-		child_index := switch_record_table[sw].switch_index[k]
+	for k := uint16(0); k < t.switch_record_table[sw].num_switches; k++ {
+		child_index := t.switch_record_table[sw].switch_index[k]
 		switchDescIndex = _merge_switches_array(
-			switch_record_table[sw].switch_desc_index,
-			switch_record_table[child_index].switch_desc_index,
+			t.switch_record_table[sw].switch_desc_index,
+			t.switch_record_table[child_index].switch_desc_index,
 		)
-		switch_record_table[sw].switch_desc_index = switchDescIndex
-		switch_record_table[sw].num_desc_switches = uint16(len(switchDescIndex))
+		t.switch_record_table[sw].switch_desc_index = switchDescIndex
+		t.switch_record_table[sw].num_desc_switches = uint16(len(switchDescIndex))
 	}
 }
 
@@ -171,67 +253,116 @@ func _merge_switches_array(a1, a2 []uint16) []uint16 {
 	return a1
 }
 
-func _check_better_path(i, j, k int) {
+func (t *Topology) _check_better_path(i, j, k int) {
 	tmp := uint32(0)
-	if switch_record_table[j].switches_dist[i] == INFINITE ||
-		switch_record_table[i].switches_dist[k] == INFINITE {
+	if t.switch_record_table[j].switches_dist[i] == INFINITE ||
+		t.switch_record_table[i].switches_dist[k] == INFINITE {
 		tmp = INFINITE
 	} else {
-		tmp = switch_record_table[j].switches_dist[i] +
-			switch_record_table[i].switches_dist[k]
+		tmp = t.switch_record_table[j].switches_dist[i] +
+			t.switch_record_table[i].switches_dist[k]
 	}
-	if switch_record_table[j].switches_dist[k] > tmp {
-		switch_record_table[j].switches_dist[k] = tmp
+	if t.switch_record_table[j].switches_dist[k] > tmp {
+		t.switch_record_table[j].switches_dist[k] = tmp
 	}
 }
 
-func _node_name2bitmap(node_names string) (*bitstr_t, error) {
-	// Regular expression to match patterns like "node[1-3,5,7-9]"
-	re := regexp.MustCompile(`([a-zA-Z-]+)\[([0-9,-]+)\]`)
-	matches := re.FindStringSubmatch(node_names)
+/* Add a node to node_record_table, unless it is already known */
+func (t *Topology) _add_node_record(name string) {
+	if _, ok := t.node_hash_table[name]; ok {
+		return
+	}
+	t.node_record_table = append(t.node_record_table, &node_record_t{
+		name:   name,
+		weight: DEFAULT_NODE_WEIGHT,
+	})
+	t.node_hash_table[name] = t.node_record_cnt
+	t.node_record_cnt++
+}
 
-	if len(matches) != 3 {
-		return nil, fmt.Errorf("invalid hostlist expression")
+/*
+ * slurmctld orders node_record_table as nodes are defined in slurm.conf.
+ * Bitmaps are walked in this order, so it is also the order nodes are
+ * selected in. Without the NodeName lines, nodes are in natural order of
+ * their names, as slurm.conf customarily defines them; nodes missing from
+ * the NodeName lines follow the defined ones in natural order.
+ */
+func (t *Topology) _sort_node_record_table() {
+	slices.SortStableFunc(t.node_record_table, func(a, b *node_record_t) int {
+		a_inx, a_ok := t.node_order[a.name]
+		b_inx, b_ok := t.node_order[b.name]
+		switch {
+		case a_ok && b_ok:
+			return a_inx - b_inx
+		case a_ok:
+			return -1
+		case b_ok:
+			return 1
+		}
+		return hostlist.Compare(a.name, b.name)
+	})
+	for i, node_ptr := range t.node_record_table {
+		t.node_hash_table[node_ptr.name] = i
 	}
+}
 
-	prefix := matches[1]
-	ranges := strings.Split(matches[2], ",")
+/* Return the index of a given node name or -1 if not found */
+func (t *Topology) _find_node_inx(name string) int {
+	if index, ok := t.node_hash_table[name]; ok {
+		return index
+	}
 
-	var my_bitmap bitstr_t
-	for _, r := range ranges {
-		if strings.Contains(r, "-") {
-			// Handle range like "1-3"
-			bounds := strings.Split(r, "-")
-			lower, err := strconv.Atoi(bounds[0])
-			if err != nil {
-				return nil, err
-			}
-			upper, err := strconv.Atoi(bounds[1])
-			if err != nil {
-				return nil, err
-			}
-			for i := lower; i <= upper; i++ {
-				format := "%s%d"
-				if strings.HasPrefix(bounds[0], "0") {
-					format = fmt.Sprintf("%%s%%0" + fmt.Sprintf("%d", len(bounds[0])) + "d")
-				}
-				bit_set(&my_bitmap, fmt.Sprintf(format, prefix, i))
-			}
-		} else {
-			// Handle single number like "5"
-			num, err := strconv.Atoi(r)
-			if err != nil {
-				return nil, err
-			}
-			format := "%s%d"
-			if strings.HasPrefix(r, "0") {
-				format = fmt.Sprintf("%%s%%0" + fmt.Sprintf("%d", len(r)) + "d")
-			}
-			bit_set(&my_bitmap, fmt.Sprintf(format, prefix, num))
+	return -1
+}
+
+/* Return a bitmap of the given node names, all of which must be known */
+func (t *Topology) _node_list2bitmap(names []string) (*bitstr_t, error) {
+	my_bitmap := bit_alloc(t.node_record_cnt)
+	for _, name := range names {
+		inx := t._find_node_inx(name)
+		if inx < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNode, name)
 		}
+		bit_set(my_bitmap, inx)
 	}
 
-	return &my_bitmap, nil
+	return my_bitmap, nil
+}
+
+func (t *Topology) _node_name2bitmap(node_names string) (*bitstr_t, error) {
+	names, err := hostlist.Expand(node_names)
+	if err != nil {
+		return nil, err
+	}
+
+	return t._node_list2bitmap(names)
+}
+
+/* Return the names of the nodes in a bitmap, in node table order */
+func (t *Topology) bitmap2hostlist(bitmap *bitstr_t) []string {
+	names := []string{}
+	if bitmap == nil {
+		return names
+	}
+	for i := bit_ffs(bitmap); i >= 0; i = bit_ffs_from_bit(bitmap, i+1) {
+		names = append(names, t.node_record_table[i].name)
+	}
+	return names
+}
+
+/* Return the hostlist expression of the nodes in a bitmap */
+func (t *Topology) bitmap2node_name(bitmap *bitstr_t) string {
+	return hostlist.Compress(t.bitmap2hostlist(bitmap))
+}
+
+/* Return a ConfigError locating the definition of switch_ptr */
+func _switch_error(switch_ptr *switch_record_t, err error) *ConfigError {
+	return &ConfigError{
+		File:   switch_ptr.file,
+		Line:   switch_ptr.line,
+		Switch: switch_ptr.name,
+		Err:    err,
+	}
 }
 
 /* Return the index of a given switch name or -1 if not found */
@@ -243,39 +374,83 @@ func _get_switch_inx(table *map[string]int, name string) int {
 	return -1
 }
 
-// XXX: Use a modern Go idiom to avoid this function
-func _switch_record_reset() {
-	switch_record_table = make([]*switch_record_t, 0)
-	switch_record_cnt = 0
+/*
+ * _resolve_switch_level determines the level and node bitmap of switch sw
+ * from those of its children, resolving the children first. This is a depth
+ * first topological sort of the switches, so any depth is supported. path
+ * holds the indexes of the switches being resolved, which form the cycle
+ * reported if sw is reached again.
+ */
+func (t *Topology) _resolve_switch_level(sw int, lookup map[string]int, visiting []bool, path []int) error {
+	switch_ptr := t.switch_record_table[sw]
+	if switch_ptr.level != -1 {
+		return nil
+	}
+	if visiting[sw] {
+		cycle := []string{}
+		for _, inx := range path[slices.Index(path, sw):] {
+			cycle = append(cycle, t.switch_record_table[inx].name)
+		}
+		cycle = append(cycle, switch_ptr.name)
+		return _switch_error(switch_ptr, fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycle, " -> ")))
+	}
 
-	node_record_table = make([]*node_record_t, 0)
-	node_record_cnt = 0
-}
+	visiting[sw] = true
+	path = append(path, sw)
 
-func switch_record_validate(filename string) error {
-	_switch_record_reset()
+	level := -1
+	for _, child := range switch_ptr.switch_names {
+		j := _get_switch_inx(&lookup, child)
+		if j < 0 {
+			return _switch_error(switch_ptr, fmt.Errorf("%w (%s)", ErrUnknownChild, child))
+		}
+		if err := t._resolve_switch_level(j, lookup, visiting, path); err != nil {
+			return err
+		}
+		if level == -1 {
+			switch_ptr.node_bitmap = bit_copy(t.switch_record_table[j].node_bitmap)
+		} else {
+			bit_or(switch_ptr.node_bitmap, t.switch_record_table[j].node_bitmap)
+		}
+		level = max(level, t.switch_record_table[j].level+1)
+	}
+	switch_ptr.level = level
 
-	ptr_array, err := _read_topo_file(filename)
-	if err != nil {
-		return err
+	visiting[sw] = false
+	return nil
+}
+
+func (t *Topology) switch_record_validate(conf *topology_conf_t) error {
+	ptr_array := conf.switches
+	if len(ptr_array) == 0 {
+		return &ConfigError{File: conf.file, Err: ErrNoSwitches}
 	}
 
-	switch_record_cnt = len(ptr_array)
-	if switch_record_cnt == 0 {
-		return fmt.Errorf("no switches configured")
+	/* Block records are only understood by topology/block */
+	for _, ptr := range conf.blocks {
+		t._diag(&ConfigError{File: ptr.file, Line: ptr.line, Block: ptr.block_name,
+			Err: fmt.Errorf("%w: BlockName", ErrUnknownKey)})
+	}
+	if ptr := conf.block_sizes; ptr != nil {
+		t._diag(&ConfigError{File: ptr.file, Line: ptr.line,
+			Err: fmt.Errorf("%w: BlockSizes", ErrUnknownKey)})
 	}
 
-	// XXX: Global variable?
 	switch_record_lookup_table := map[string]int{}
-	node_record_lookup_table := map[string]int{}
-
-	for i, ptr := range ptr_array {
-		switch_ptr := &switch_record_t{}
+	t.node_hash_table = map[string]int{}
+
+	for _, ptr := range ptr_array {
+		/* Top-level switches are their own parent */
+		switch_ptr := &switch_record_t{
+			parent: uint16(len(t.switch_record_table)),
+			file:   ptr.file,
+			line:   ptr.line,
+		}
 
 		switch_ptr.name = ptr.switch_name
 		/* See if switch name has already been defined. */
 		if _, ok := switch_record_lookup_table[ptr.switch_name]; ok {
-			log.Errorf("Switch (%s) has already been defined", switch_ptr.name)
+			t._diag(_switch_error(switch_ptr, ErrDuplicateSwitch))
 			continue
 		}
 
@@ -283,87 +458,54 @@ func switch_record_validate(filename string) error {
 		if len(ptr.nodes) > 0 {
 			switch_ptr.level = 0 /* leaf switch */
 			switch_ptr.nodes = strings.Clone(ptr.nodes)
-			node_bitmap, err := _node_name2bitmap(ptr.nodes)
+			names, err := hostlist.Expand(ptr.nodes)
 			if err != nil {
-				log.Fatalf("Invalid node name (%s) in switch config (%s)",
-					ptr.nodes, ptr.switch_name)
-			} else {
-				switch_ptr.node_bitmap = node_bitmap
-
-				// XXX: Add nodes to node_record_table
-				for _, name := range *node_bitmap {
-					if _, ok := node_record_lookup_table[name]; !ok {
-						node_ptr := &node_record_t{
-							name: name,
-						}
-						node_record_table = append(node_record_table, node_ptr)
-						node_record_lookup_table[name] = node_record_cnt
-						node_record_cnt++
-					}
-				}
+				return _switch_error(switch_ptr, fmt.Errorf("invalid node name: %w", err))
+			}
+			/* Add nodes to node_record_table, bitmaps are built once all are known */
+			for _, name := range names {
+				t._add_node_record(name)
 			}
 		} else if len(ptr.switches) > 0 {
 			switch_ptr.level = -1 /* determine later */
 			switch_ptr.switches = strings.Clone(ptr.switches)
-			switch_bitmap, err := _node_name2bitmap(ptr.switches)
+			switch_names, err := hostlist.Expand(ptr.switches)
 			if err != nil {
-				log.Fatalf("Invalid switch name (%s) in switch config (%s)",
-					ptr.switches, ptr.switch_name)
-			} else {
-				switch_ptr.switch_bitmap = switch_bitmap
+				return _switch_error(switch_ptr, fmt.Errorf("invalid switch name: %w", err))
 			}
+			switch_ptr.switch_names = switch_names
 		} else {
-			log.Fatalf("Switch configuration (%s) lacks children", ptr.switch_name)
+			return _switch_error(switch_ptr, ErrNoChildren)
 		}
 
-		switch_record_lookup_table[ptr.switch_name] = i
-		switch_record_table = append(switch_record_table, switch_ptr)
+		switch_record_lookup_table[ptr.switch_name] = len(t.switch_record_table)
+		t.switch_record_table = append(t.switch_record_table, switch_ptr)
 	}
+	t.switch_record_cnt = len(t.switch_record_table)
 
-	for depth := 1; ; depth++ {
-		resolved := true
+	t._sort_node_record_table()
 
-		for i := 0; i < switch_record_cnt; i++ {
-			switch_ptr := switch_record_table[i]
-			if switch_ptr.level != -1 {
-				continue
-			}
-			for p := bit_set_count(switch_ptr.switch_bitmap) - 1; p >= 0; p-- {
-				child := (*switch_ptr.switch_bitmap)[p]
-				j := _get_switch_inx(&switch_record_lookup_table, child)
-				if j < 0 || j == i {
-					log.Fatalf("Switch configuration %s has invalid child (%s)",
-						switch_ptr.name, child)
-				}
-				if switch_record_table[j].level == -1 {
-					/* Children not resolved */
-					resolved = false
-					switch_ptr.level = -1
-					break
-				}
-				if switch_ptr.level == -1 {
-					switch_ptr.level = switch_record_table[j].level + 1
-					switch_ptr.node_bitmap = bit_copy(switch_record_table[j].node_bitmap)
-				} else {
-					switch_ptr.level = max(switch_ptr.level, switch_record_table[j].level+1)
-					bit_or(switch_ptr.node_bitmap, switch_record_table[j].node_bitmap)
-				}
-			}
+	for _, switch_ptr := range t.switch_record_table {
+		if switch_ptr.level == 0 {
+			switch_ptr.node_bitmap, _ = t._node_name2bitmap(switch_ptr.nodes)
 		}
-		if resolved {
-			break
-		}
-		if depth > 20 {
-			log.Fatal("Switch configuration is not a tree")
+	}
+
+	/* Resolve levels of all non-leaf switches */
+	visiting := make([]bool, t.switch_record_cnt)
+	for i := 0; i < t.switch_record_cnt; i++ {
+		err := t._resolve_switch_level(i, switch_record_lookup_table, visiting, nil)
+		if err != nil {
+			return err
 		}
 	}
 
 	switchlevels := 0
-	for i := 0; i < switch_record_cnt; i++ {
-		switchlevels = max(switchlevels, switch_record_table[i].level)
-		switch_ptr := switch_record_table[i]
+	for i := 0; i < t.switch_record_cnt; i++ {
+		switchlevels = max(switchlevels, t.switch_record_table[i].level)
+		switch_ptr := t.switch_record_table[i]
 		if bit_set_count(switch_ptr.node_bitmap) == 0 {
-			log.Errorf("switch %s has no nodes", switch_ptr.name)
+			t._diag(_switch_error(switch_ptr, ErrNoNodes))
 		}
 	}
 
@@ -371,45 +513,45 @@ func switch_record_validate(filename string) error {
 
 	/* Create array of indexes of children of each switch,
 	 * and see if any switch can reach all nodes */
-	for i := 0; i < switch_record_cnt; i++ {
-		if switch_record_table[i].level != 0 {
-			_find_child_switches(switch_record_lookup_table[switch_record_table[i].name])
+	for i := 0; i < t.switch_record_cnt; i++ {
+		if t.switch_record_table[i].level != 0 {
+			t._find_child_switches(switch_record_lookup_table[t.switch_record_table[i].name])
 		}
 	}
 
-	for i := 0; i < switch_record_cnt; i++ {
-		switch_record_table[i].switches_dist = make([]uint32, switch_record_cnt)
-		switch_record_table[i].switch_desc_index = make([]uint16, 0)
-		switch_record_table[i].num_desc_switches = 0
+	for i := 0; i < t.switch_record_cnt; i++ {
+		t.switch_record_table[i].switches_dist = make([]uint32, t.switch_record_cnt)
+		t.switch_record_table[i].switch_desc_index = make([]uint16, 0)
+		t.switch_record_table[i].num_desc_switches = 0
 	}
 
-	for i := 0; i < switch_record_cnt; i++ {
-		for j := i + 1; j < switch_record_cnt; j++ {
-			switch_record_table[i].switches_dist[j] = INFINITE
-			switch_record_table[j].switches_dist[i] = INFINITE
+	for i := 0; i < t.switch_record_cnt; i++ {
+		for j := i + 1; j < t.switch_record_cnt; j++ {
+			t.switch_record_table[i].switches_dist[j] = INFINITE
+			t.switch_record_table[j].switches_dist[i] = INFINITE
 		}
-		for j := 0; j < int(switch_record_table[i].num_switches); j++ {
-			child := switch_record_table[i].switch_index[j]
+		for j := 0; j < int(t.switch_record_table[i].num_switches); j++ {
+			child := t.switch_record_table[i].switch_index[j]
 
-			switch_record_table[i].switches_dist[child] = 1
-			switch_record_table[child].switches_dist[i] = 1
+			t.switch_record_table[i].switches_dist[child] = 1
+			t.switch_record_table[child].switches_dist[i] = 1
 		}
 	}
 
-	for i := 0; i < switch_record_cnt; i++ {
-		for j := 0; j < switch_record_cnt; j++ {
-			for k := 0; k < switch_record_cnt; k++ {
-				_check_better_path(i, j, k)
+	for i := 0; i < t.switch_record_cnt; i++ {
+		for j := 0; j < t.switch_record_cnt; j++ {
+			for k := 0; k < t.switch_record_cnt; k++ {
+				t._check_better_path(i, j, k)
 			}
 		}
 	}
 
 	for i := 1; i <= switchlevels; i++ {
-		for j := 0; j < switch_record_cnt; j++ {
-			if switch_record_table[j].level != i {
+		for j := 0; j < t.switch_record_cnt; j++ {
+			if t.switch_record_table[j].level != i {
 				continue
 			}
-			_find_desc_switches(j)
+			t._find_desc_switches(j)
 		}
 	}
 
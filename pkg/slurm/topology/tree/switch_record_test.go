@@ -1,7 +1,10 @@
 package tree
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -13,25 +16,55 @@ var topologies = []string{
 	"../../../../test/topology3.conf",
 }
 
+/* Write a topology configuration to a temporary file and return its name */
+func _write_topo_file(tb testing.TB, content string) string {
+	filename := filepath.Join(tb.TempDir(), "topology.conf")
+	require.NoError(tb, os.WriteFile(filename, []byte(content), 0644))
+	return filename
+}
+
 func Test__node_name2bitmap(t *testing.T) {
-	bitmap, err := _node_name2bitmap("node[1-3,5,7-9]")
+	topo, err := Load("../../../../test/topology3.conf")
+	require.NoError(t, err)
+
+	bitmap, err := topo._node_name2bitmap("worker[001-003,005,007-009]")
 	require.NoError(t, err)
-	require.Equal(t, &bitstr_t{"node1", "node2", "node3", "node5", "node7", "node8", "node9"}, bitmap)
+	require.Equal(t, 7, bit_set_count(bitmap))
+	require.Equal(t, []string{"worker001", "worker002", "worker003", "worker005", "worker007", "worker008", "worker009"}, topo.bitmap2hostlist(bitmap))
 
-	bitmap, err = _node_name2bitmap("node[1]")
+	bitmap, err = topo._node_name2bitmap("worker001")
 	require.NoError(t, err)
-	require.Equal(t, &bitstr_t{"node1"}, bitmap)
+	require.Equal(t, []string{"worker001"}, topo.bitmap2hostlist(bitmap))
 
-	bitmap, err = _node_name2bitmap("node1")
+	bitmap, err = topo._node_name2bitmap("worker[001-003")
 	require.Error(t, err)
 	require.Nil(t, bitmap)
 
-	bitmap, err = _node_name2bitmap("worker[001,134-136,140]")
+	bitmap, err = topo._node_name2bitmap("worker[001,041]")
+	require.Error(t, err)
+	require.Nil(t, bitmap)
+}
+
+func Test_bitmap2node_name(t *testing.T) {
+	topo, err := Load("../../../../test/topology2.conf")
+	require.NoError(t, err)
+
+	require.Equal(t, "", topo.bitmap2node_name(nil))
+	bitmap, err := topo._node_name2bitmap("tux[15,4,5,6,12-14]")
 	require.NoError(t, err)
-	require.Equal(t, &bitstr_t{"worker001", "worker134", "worker135", "worker136", "worker140"}, bitmap)
+	require.Equal(t, "tux[4-6,12-15]", topo.bitmap2node_name(bitmap))
+}
+
+/* Read filename and build the switch records of tp */
+func _switch_record_load(tp *Topology, filename string) error {
+	conf, err := tp._read_topo_file(filename, nil)
+	if err != nil {
+		return err
+	}
+	return tp.switch_record_validate(conf)
 }
 
-func Test__parse_switches(t *testing.T) {
+func Test__parse_topo_conf(t *testing.T) {
 	for i, topo := range topologies {
 		f, err := os.Open(topo)
 		if err != nil {
@@ -39,7 +72,7 @@ func Test__parse_switches(t *testing.T) {
 		}
 		defer f.Close()
 
-		list, err := _parse_switches(f)
+		conf, err := (&Topology{})._parse_topo_conf(f, topo, nil)
 		require.NoError(t, err)
 
 		expected := 7
@@ -48,13 +81,13 @@ func Test__parse_switches(t *testing.T) {
 		} else if i == 2 {
 			expected = 24
 		}
-		require.Equal(t, expected, len(list))
+		require.Equal(t, expected, len(conf.switches))
 	}
 }
 
 func Test__read_topo_file(t *testing.T) {
 	for i, topo := range topologies {
-		list, err := _read_topo_file(topo)
+		conf, err := (&Topology{})._read_topo_file(topo, nil)
 		require.NoError(t, err)
 
 		expected := 7
@@ -63,7 +96,7 @@ func Test__read_topo_file(t *testing.T) {
 		} else if i == 2 {
 			expected = 24
 		}
-		require.Equal(t, expected, len(list))
+		require.Equal(t, expected, len(conf.switches))
 	}
 }
 
@@ -81,18 +114,192 @@ func Test__merge_switches_array(t *testing.T) {
 
 func Test_switch_record_validate(t *testing.T) {
 	for i, topo := range topologies {
-		switch_record_table = make([]*switch_record_t, 0)
-		switch_record_cnt = 0
-
-		err := switch_record_validate(topo)
+		tp := &Topology{}
+		err := _switch_record_load(tp, topo)
 		require.NoError(t, err)
-		require.NotEmpty(t, switch_record_table)
+		require.NotEmpty(t, tp.switch_record_table)
 		expected := 7
 		if i == 1 {
 			expected = 8
 		} else if i == 2 {
 			expected = 24
 		}
-		require.Equal(t, expected, switch_record_cnt)
+		require.Equal(t, expected, tp.switch_record_cnt)
+	}
+}
+
+func Test_switch_record_validate_errors(t *testing.T) {
+	tests := []struct {
+		content string
+		err     error
+		line    int
+		switch_ string
+	}{
+		{"# no switches\n", ErrNoSwitches, 0, ""},
+		{"SwitchName=s0 Nodes=tux[0-1\n", ErrInvalidHostlist, 1, "s0"},
+		{"SwitchName=s0 Nodes=tux[0-1]\nSwitchName=s1 Switches=s[0-1\n", ErrInvalidHostlist, 2, "s1"},
+		{"SwitchName=s0 Nodes=tux[0-1]\nSwitchName=s1 Switches=s[0,2]\n", ErrUnknownChild, 2, "s1"},
+		{"SwitchName=s0 Nodes=tux[0-1]\n\nSwitchName=s1 Switches=s[0-1]\n", ErrCycle, 3, "s1"},
+		{"SwitchName=s0 Nodes=tux[0-1]\nSwitchName=s4 Switches=s[0,6]\nSwitchName=s6 Switches=s4\n", ErrCycle, 2, "s4"},
+	}
+	for _, test := range tests {
+		filename := _write_topo_file(t, test.content)
+		err := _switch_record_load(&Topology{}, filename)
+		require.ErrorIs(t, err, test.err, test.content)
+
+		var config_err *ConfigError
+		require.True(t, errors.As(err, &config_err), test.content)
+		require.Equal(t, filename, config_err.File)
+		require.Equal(t, test.line, config_err.Line)
+		require.Equal(t, test.switch_, config_err.Switch)
 	}
+
+	err := _switch_record_load(&Topology{}, "../../../../test/nonexistent.conf")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.EqualError(t, err, "../../../../test/nonexistent.conf: open ../../../../test/nonexistent.conf: no such file or directory")
+}
+
+func TestConfigError(t *testing.T) {
+	err := &ConfigError{File: "topology.conf", Line: 3, Switch: "s1", Err: ErrUnknownChild}
+	require.EqualError(t, err, "topology.conf:3: switch s1: invalid child switch")
+	require.ErrorIs(t, err, ErrUnknownChild)
+
+	err = &ConfigError{File: "topology.conf", Err: ErrNoSwitches}
+	require.EqualError(t, err, "topology.conf: no switches configured")
+}
+
+func Test_switch_record_validate_diagnostics(t *testing.T) {
+	filename := _write_topo_file(t, `SwitchName=s0 Nodes=tux[0-1] LinkSpeed=fast
+SwitchName=s1 Nodes=tux[2-3] Switches=s0
+SwitchName=s2
+SwitchName=s0 Nodes=tux[4-5]
+SwitchName=s3 Switches=s0
+`)
+
+	/* Lenient loading skips the problems, as Slurm does */
+	topo, err := Load(filename)
+	require.NoError(t, err)
+	require.Equal(t, 2, topo.switch_record_cnt)
+	require.Equal(t, []string{"tux0", "tux1"}, topo.Nodes())
+
+	diags := topo.Diagnostics()
+	require.Len(t, diags, 4)
+	for i, expected := range []struct {
+		err     error
+		line    int
+		switch_ string
+	}{
+		{ErrInvalidLinkSpeed, 1, "s0"},
+		{ErrMixedChildren, 2, "s1"},
+		{ErrNoChildren, 3, "s2"},
+		{ErrDuplicateSwitch, 4, "s0"},
+	} {
+		require.ErrorIs(t, diags[i], expected.err)
+		require.Equal(t, filename, diags[i].File)
+		require.Equal(t, expected.line, diags[i].Line)
+		require.Equal(t, expected.switch_, diags[i].Switch)
+	}
+
+	/* Strict loading reports all of them */
+	topo, err = Load(filename, WithStrict())
+	require.Nil(t, topo)
+	var validation_err *ValidationError
+	require.True(t, errors.As(err, &validation_err))
+	require.Equal(t, diags, validation_err.Diagnostics)
+	require.ErrorIs(t, err, ErrDuplicateSwitch)
+	require.Contains(t, err.Error(), "4 configuration problem(s) found")
+	require.Contains(t, err.Error(), filename+":2: switch s1: switch has both child switches and nodes")
+
+	for _, topo := range topologies {
+		require.NoError(t, SwitchRecordValidate(topo, WithStrict()))
+	}
+}
+
+func Test__resolve_switch_level(t *testing.T) {
+	/* A deep chain defined top down, which needs one pass per level to resolve naively */
+	content := ""
+	for i := 29; i > 0; i-- {
+		content += fmt.Sprintf("SwitchName=s%d Switches=s%d\n", i, i-1)
+	}
+	content += "SwitchName=s0 Nodes=tux[0-3]\n"
+	topo, err := Load(_write_topo_file(t, content))
+	require.NoError(t, err)
+	switches := topo.Switches()
+	require.Equal(t, "s29", switches[0].Name)
+	require.Equal(t, 29, switches[0].Level)
+	require.Equal(t, "", switches[0].Parent)
+	require.Equal(t, []string{"tux0", "tux1", "tux2", "tux3"}, switches[0].Nodes)
+	require.Equal(t, "s1", switches[28].Name)
+	require.Equal(t, 1, switches[28].Level)
+	require.Equal(t, "s2", switches[28].Parent)
+
+	/* Levels come from the longest path to a leaf */
+	topo, err = Load(_write_topo_file(t, `SwitchName=top Switches=mid,s0
+SwitchName=mid Switches=s1
+SwitchName=s0 Nodes=tux[0-1]
+SwitchName=s1 Nodes=tux[2-3]
+`))
+	require.NoError(t, err)
+	require.Equal(t, 2, topo.Switches()[0].Level)
+	require.Equal(t, []string{"tux0", "tux1", "tux2", "tux3"}, topo.Switches()[0].Nodes)
+
+	/* The exact cycle is reported */
+	_, err = Load(_write_topo_file(t, `SwitchName=s0 Nodes=tux[0-1]
+SwitchName=s1 Nodes=tux[2-3]
+SwitchName=s6 Switches=s[4-5]
+SwitchName=s4 Switches=s0
+SwitchName=s5 Switches=s[1,7]
+SwitchName=s7 Switches=s8
+SwitchName=s8 Switches=s5
+`))
+	require.ErrorIs(t, err, ErrCycle)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), ":5: switch s5: switch configuration is not a tree: s5 -> s7 -> s8 -> s5")
+
+	_, err = Load(_write_topo_file(t, "SwitchName=s0 Nodes=tux0\nSwitchName=s1 Switches=s[0-1]\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "s1 -> s1")
+}
+
+func Test__parse_topo_conf_grammar(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "topology.d"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "topology.d", "leaf0.conf"), []byte(
+		"switchname=s0 nodes=tux[0-3] # leaf\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "topology.d", "leaf1.conf"), []byte(
+		"SWITCHNAME=s1\tNODES=tux[4-7]\tLINKSPEED=900\n"), 0644))
+	filename := filepath.Join(dir, "topology.conf")
+	require.NoError(t, os.WriteFile(filename, []byte(`# topology.conf
+Include topology.d/leaf*.conf
+SwitchName=s2   Switches=s[0-1] \
+	LinkSpeed=1800   # spine
+`), 0644))
+
+	topo, err := Load(filename, WithStrict())
+	require.NoError(t, err)
+	switches := topo.Switches()
+	require.Len(t, switches, 3)
+	require.Equal(t, Switch{Name: "s1", Parent: "s2", Switches: []string{},
+		Nodes: []string{"tux4", "tux5", "tux6", "tux7"}, LinkSpeed: 900}, switches[1])
+	require.Equal(t, Switch{Name: "s2", Level: 1, Switches: []string{"s0", "s1"},
+		Nodes: []string{"tux0", "tux1", "tux2", "tux3", "tux4", "tux5", "tux6", "tux7"}, LinkSpeed: 1800}, switches[2])
+
+	/* Problems in included files are reported against them */
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "topology.d", "leaf1.conf"), []byte(
+		"\nSwitchName=s1 Nodes=tux[4-7] Color=blue\n"), 0644))
+	_, err = Load(filename, WithStrict())
+	require.ErrorIs(t, err, ErrUnknownKey)
+	require.Contains(t, err.Error(), filepath.Join(dir, "topology.d", "leaf1.conf")+":2: switch s1: unrecognized key: Color")
+
+	/* A missing or recursive Include fails */
+	require.NoError(t, os.WriteFile(filename, []byte("Include missing.conf\n"), 0644))
+	_, err = Load(filename)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, os.WriteFile(filename, []byte("Include topology.conf\n"), 0644))
+	_, err = Load(filename)
+	require.ErrorIs(t, err, ErrSyntax)
+
+	require.NoError(t, os.WriteFile(filename, []byte("Nodes=tux[0-3]\n"), 0644))
+	_, err = Load(filename)
+	require.ErrorIs(t, err, ErrSyntax)
 }
@@ -4,6 +4,18 @@ type topology_eval_t struct {
 	node_map        *bitstr_t /* available/selected nodes */
 	req_nodes       uint32    /* number of requested nodes */
 	leaf_switch_cnt uint16    /* number of leaf switches */
+	leaf_switches   []int     /* indexes of leaf switches (blocks) used */
+	top_switch_inx  int       /* switch connecting the selected nodes, -1 if none */
+	switches_dist   []uint32  /* distance of switches to those used, if computed */
+	trace           *Trace    /* decisions of the evaluation, nil if not traced */
 	// XXX: Originally from job_record_t
 	req_node_bitmap *bitstr_t /* bitmap of required nodes */
 }
+
+/* Select nodes for a job with the configured topology plugin */
+func (t *Topology) topology_g_eval_nodes(topo_eval *topology_eval_t) int {
+	if t.plugin == PluginBlock {
+		return t.eval_nodes_block(topo_eval)
+	}
+	return t.eval_nodes_tree(topo_eval, t.have_dragonfly)
+}
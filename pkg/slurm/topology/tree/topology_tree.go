@@ -1,6 +1,9 @@
 package tree
 
 import (
+	"cmp"
+	"slices"
+
 	log "github.com/sirupsen/logrus"
 )
 
@@ -8,34 +11,53 @@ import (
  * When TopologyParam=SwitchAsNodeRank is set, this plugin assigns a unique
  * node_rank for all nodes belonging to the same leaf switch.
  */
-func topology_p_generate_node_ranking(filename string) error {
+func (t *Topology) topology_p_generate_node_ranking() bool {
 	/* By default, node_rank is 0, so start at 1 */
 	switch_rank := 1
 
-	log.Debugf("Generating node ranking %d", switch_rank)
-
-	err := switch_record_validate(filename)
-	if err != nil {
-		return err
+	if t.switch_record_cnt == 0 {
+		return false
 	}
 
-	for sw := 0; sw < switch_record_cnt; sw++ {
+	log.Debugf("Generating node ranking %d", switch_rank)
+
+	for sw := 0; sw < t.switch_record_cnt; sw++ {
 		/* skip if not a leaf switch */
-		if switch_record_table[sw].level != 0 {
+		if t.switch_record_table[sw].level != 0 {
 			continue
 		}
 
-		for n := 0; n < node_record_cnt; n++ {
-			if !bit_test(switch_record_table[sw].node_bitmap, node_record_table[n].name) {
-				continue
-			}
-
-			node_record_table[n].node_rank = switch_rank
-			log.Debugf("node=%s rank=%d", node_record_table[n].name, switch_rank)
+		node_bitmap := t.switch_record_table[sw].node_bitmap
+		for n := bit_ffs(node_bitmap); n >= 0; n = bit_ffs_from_bit(node_bitmap, n+1) {
+			t.node_record_table[n].node_rank = switch_rank
+			log.Tracef("node=%s rank=%d", t.node_record_table[n].name, switch_rank)
 		}
 
 		switch_rank++
 	}
 
-	return nil
+	return true
+}
+
+/*
+ * Order node_record_table by node_rank, as slurmctld does once ranks are
+ * generated, so nodes are selected and listed leaf switch by leaf switch.
+ * Nodes of the same rank keep their order.
+ */
+func (t *Topology) _sort_nodes_by_rank() {
+	old_table := slices.Clone(t.node_record_table)
+	slices.SortStableFunc(t.node_record_table, func(a, b *node_record_t) int {
+		return cmp.Compare(a.node_rank, b.node_rank)
+	})
+	for i, node_ptr := range t.node_record_table {
+		t.node_hash_table[node_ptr.name] = i
+	}
+
+	for _, switch_ptr := range t.switch_record_table {
+		node_bitmap := bit_alloc(t.node_record_cnt)
+		for i := bit_ffs(switch_ptr.node_bitmap); i >= 0; i = bit_ffs_from_bit(switch_ptr.node_bitmap, i+1) {
+			bit_set(node_bitmap, t.node_hash_table[old_table[i].name])
+		}
+		switch_ptr.node_bitmap = node_bitmap
+	}
 }
@@ -2,13 +2,57 @@ package tree
 
 import (
 	"testing"
+
+	"github.com/stretchr/testify/require"
 )
 
 func Test_topology_p_generate_node_ranking(t *testing.T) {
 	for _, topo := range topologies {
-		node_record_table = make([]*node_record_t, 0)
-		node_record_cnt = 0
+		tp, err := Load(topo)
+		require.NoError(t, err)
 
-		topology_p_generate_node_ranking(topo)
+		require.True(t, tp.topology_p_generate_node_ranking())
+		for _, node_ptr := range tp.node_record_table {
+			require.NotZero(t, node_ptr.node_rank)
+		}
 	}
+
+	tp, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{
+		"tu-x0": 1, "tu-x1": 1, "tu-x2": 2, "tu-x3": 2,
+		"tux4": 3, "tux5": 3, "tux6": 4, "tux7": 4,
+	}, tp.GenerateNodeRanking())
+
+	tp, err = Load("../../../../test/block1.conf")
+	require.NoError(t, err)
+	require.False(t, tp.topology_p_generate_node_ranking())
+	require.Empty(t, tp.GenerateNodeRanking())
+}
+
+func Test__sort_nodes_by_rank(t *testing.T) {
+	filename := _write_topo_file(t, "SwitchName=s0 Nodes=tux[4-5]\n"+
+		"SwitchName=s1 Nodes=tux[0-1]\n"+
+		"SwitchName=s2 Nodes=tux[2-3]\n"+
+		"SwitchName=s3 Switches=s[0-2]\n")
+
+	tp, err := Load(filename)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux0", "tux1", "tux2", "tux3", "tux4", "tux5"}, tp.Nodes())
+	selection, err := tp.Eval(tp.Nodes(), nil, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux0", "tux4", "tux5"}, selection.Nodes)
+
+	tp, err = Load(filename, WithSwitchAsNodeRank())
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux4", "tux5", "tux0", "tux1", "tux2", "tux3"}, tp.Nodes())
+	require.Equal(t, map[string]int{
+		"tux0": 2, "tux1": 2, "tux2": 3, "tux3": 3, "tux4": 1, "tux5": 1,
+	}, tp.GenerateNodeRanking())
+	require.Equal(t, []string{"tux2", "tux3"}, tp.Switches()[2].Nodes)
+	require.Equal(t, []string{"tux4", "tux5", "tux0", "tux1", "tux2", "tux3"}, tp.Switches()[3].Nodes)
+
+	selection, err = tp.Eval(tp.Nodes(), nil, 3)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tux4", "tux5", "tux0"}, selection.Nodes)
 }
@@ -0,0 +1,373 @@
+package tree
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultYAMLConfigName is the default file name of the named topologies.
+const DefaultYAMLConfigName = "topology.yaml"
+
+var (
+	// ErrNoTopologies is returned when a topology.yaml file defines no
+	// topologies.
+	ErrNoTopologies = errors.New("no topologies configured")
+	// ErrDuplicateTopology is returned when a topology name is defined more
+	// than once.
+	ErrDuplicateTopology = errors.New("topology has already been defined")
+	// ErrUnknownTopology is returned when no topology has the name asked for.
+	ErrUnknownTopology = errors.New("topology not found")
+	// ErrUnknownPartition is returned when a partition is not defined.
+	ErrUnknownPartition = errors.New("partition not found")
+	// ErrFlatTopology is returned when the topology asked for is flat, so
+	// there is no switch or block to evaluate jobs on.
+	ErrFlatTopology = errors.New("topology is flat, it has no switches")
+)
+
+/* Entries of a topology.yaml file, see topology.yaml(5) */
+type yaml_switch_t struct {
+	Switch    string `yaml:"switch"`
+	Children  string `yaml:"children,omitempty"`
+	Nodes     string `yaml:"nodes,omitempty"`
+	LinkSpeed uint32 `yaml:"link_speed,omitempty"`
+	line      int    /* line number in file */
+}
+
+type yaml_block_t struct {
+	Block string `yaml:"block"`
+	Nodes string `yaml:"nodes,omitempty"`
+	line  int    /* line number in file */
+}
+
+type yaml_tree_t struct {
+	Switches []*yaml_switch_t `yaml:"switches"`
+}
+
+type yaml_blocks_t struct {
+	BlockSizes []int           `yaml:"block_sizes,omitempty"`
+	Blocks     []*yaml_block_t `yaml:"blocks"`
+	line       int             /* line number in file */
+}
+
+type yaml_topology_t struct {
+	Topology       string         `yaml:"topology"`
+	ClusterDefault bool           `yaml:"cluster_default"`
+	Tree           *yaml_tree_t   `yaml:"tree,omitempty"`
+	Block          *yaml_blocks_t `yaml:"block,omitempty"`
+	Flat           bool           `yaml:"flat,omitempty"`
+	line           int            /* line number in file */
+}
+
+/*
+ * _decode_yaml decodes value into the struct v points to. Node.Decode does
+ * not reject unknown keys as a decoder with KnownFields does, so they are
+ * checked against the yaml tags of v.
+ */
+func _decode_yaml(value *yaml.Node, v any) error {
+	if value.Kind == yaml.MappingNode {
+		typ := reflect.TypeOf(v).Elem()
+		keys := make([]string, 0, typ.NumField())
+		for i := 0; i < typ.NumField(); i++ {
+			if tag, ok := typ.Field(i).Tag.Lookup("yaml"); ok {
+				name, _, _ := strings.Cut(tag, ",")
+				keys = append(keys, name)
+			}
+		}
+		for i := 0; i < len(value.Content); i += 2 {
+			if key := value.Content[i]; !slices.Contains(keys, key.Value) {
+				return fmt.Errorf("line %d: unknown key %q, expected one of %s",
+					key.Line, key.Value, strings.Join(keys, ", "))
+			}
+		}
+	}
+	return value.Decode(v)
+}
+
+func (s *yaml_switch_t) UnmarshalYAML(value *yaml.Node) error {
+	type plain yaml_switch_t
+	s.line = value.Line
+	return _decode_yaml(value, (*plain)(s))
+}
+
+func (b *yaml_block_t) UnmarshalYAML(value *yaml.Node) error {
+	type plain yaml_block_t
+	b.line = value.Line
+	return _decode_yaml(value, (*plain)(b))
+}
+
+func (tr *yaml_tree_t) UnmarshalYAML(value *yaml.Node) error {
+	type plain yaml_tree_t
+	return _decode_yaml(value, (*plain)(tr))
+}
+
+func (b *yaml_blocks_t) UnmarshalYAML(value *yaml.Node) error {
+	type plain yaml_blocks_t
+	b.line = value.Line
+	return _decode_yaml(value, (*plain)(b))
+}
+
+func (e *yaml_topology_t) UnmarshalYAML(value *yaml.Node) error {
+	type plain yaml_topology_t
+	e.line = value.Line
+	return _decode_yaml(value, (*plain)(e))
+}
+
+/*
+ * _yaml_conf returns the records of the tree or block of entry e, skipping
+ * the records a topology.conf line could not define either.
+ */
+func (t *Topology) _yaml_conf(e *yaml_topology_t, filename string) *topology_conf_t {
+	conf := &topology_conf_t{file: filename}
+	if e.Tree != nil {
+		for _, sw := range e.Tree.Switches {
+			switches := &slurm_conf_switches_t{
+				link_speed:  sw.LinkSpeed,
+				nodes:       sw.Nodes,
+				switch_name: sw.Switch,
+				switches:    sw.Children,
+				file:        filename,
+				line:        sw.line,
+			}
+			if len(switches.nodes) > 0 && len(switches.switches) > 0 {
+				t._diag(&ConfigError{File: filename, Line: sw.line, Switch: sw.Switch, Err: ErrMixedChildren})
+				continue
+			}
+			if len(switches.nodes) == 0 && len(switches.switches) == 0 {
+				t._diag(&ConfigError{File: filename, Line: sw.line, Switch: sw.Switch, Err: ErrNoChildren})
+				continue
+			}
+			conf.switches = append(conf.switches, switches)
+		}
+	}
+	if e.Block != nil {
+		for _, block := range e.Block.Blocks {
+			if len(block.Nodes) == 0 {
+				t._diag(&ConfigError{File: filename, Line: block.line, Block: block.Block, Err: ErrNoBlockNodes})
+				continue
+			}
+			conf.blocks = append(conf.blocks, &slurm_conf_block_t{
+				block_name: block.Block,
+				nodes:      block.Nodes,
+				file:       filename,
+				line:       block.line,
+			})
+		}
+		if len(e.Block.BlockSizes) > 0 {
+			sizes := make([]string, 0, len(e.Block.BlockSizes))
+			for _, size := range e.Block.BlockSizes {
+				sizes = append(sizes, strconv.Itoa(size))
+			}
+			conf.block_sizes = &slurm_conf_block_sizes_t{
+				block_sizes: strings.Join(sizes, ","),
+				file:        filename,
+				line:        e.Block.line,
+			}
+		}
+	}
+	return conf
+}
+
+// NamedTopology is a topology of a topology.yaml file.
+type NamedTopology struct {
+	// Name is the name partitions select the topology by.
+	Name string
+	// ClusterDefault tells whether the partitions that do not select a
+	// topology use this one.
+	ClusterDefault bool
+	// Flat tells whether the topology is flat: Slurm places jobs without
+	// regard to the network, and Topology is nil.
+	Flat bool
+	// Topology is the switch hierarchy or the set of blocks.
+	Topology *Topology
+}
+
+// Topologies are the named topologies of a topology.yaml file, in file
+// order.
+type Topologies []NamedTopology
+
+// LoadYAML loads and validates the named topologies of a topology.yaml file.
+// Each topology is loaded with opts and the plugin of its tree or block
+// entry. Flat topologies, which have no switches, are kept with Flat set.
+func LoadYAML(filename string, opts ...LoadOption) (Topologies, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, &ConfigError{File: filename, Err: err}
+	}
+	defer f.Close()
+
+	log.Tracef("Reading the %s file", filename)
+
+	return LoadYAMLReader(f, filename, opts...)
+}
+
+// LoadYAMLReader loads and validates the named topologies of a topology.yaml
+// file read from r, called name in errors.
+func LoadYAMLReader(r io.Reader, name string, opts ...LoadOption) (Topologies, error) {
+	entries := []*yaml_topology_t{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&entries); err != nil && err != io.EOF {
+		return nil, &ConfigError{File: name, Err: fmt.Errorf("%w: %v", ErrSyntax, err)}
+	}
+
+	topologies := Topologies{}
+	names := map[string]bool{}
+	for _, e := range entries {
+		if e.Topology == "" {
+			return nil, &ConfigError{File: name, Line: e.line, Err: fmt.Errorf("%w: missing topology", ErrSyntax)}
+		}
+		if names[e.Topology] {
+			return nil, &ConfigError{File: name, Line: e.line,
+				Err: fmt.Errorf("%w: %s", ErrDuplicateTopology, e.Topology)}
+		}
+		names[e.Topology] = true
+
+		var plugin string
+		kinds := 0
+		if e.Tree != nil {
+			plugin = PluginTree
+			kinds++
+		}
+		if e.Block != nil {
+			plugin = PluginBlock
+			kinds++
+		}
+		if e.Flat {
+			kinds++
+		}
+		if kinds != 1 {
+			return nil, &ConfigError{File: name, Line: e.line,
+				Err: fmt.Errorf("%w: topology %s must define one of tree, block or flat", ErrSyntax, e.Topology)}
+		}
+		if e.Flat {
+			topologies = append(topologies, NamedTopology{
+				Name:           e.Topology,
+				ClusterDefault: e.ClusterDefault,
+				Flat:           true,
+			})
+			continue
+		}
+
+		t := &Topology{}
+		conf := t._yaml_conf(e, name)
+		topo, err := t._load(conf, append(slices.Clip(opts), WithPlugin(plugin)))
+		if err != nil {
+			return nil, fmt.Errorf("topology %s: %w", e.Topology, err)
+		}
+		topologies = append(topologies, NamedTopology{
+			Name:           e.Topology,
+			ClusterDefault: e.ClusterDefault,
+			Topology:       topo,
+		})
+	}
+	if len(topologies) == 0 {
+		return nil, &ConfigError{File: name, Err: ErrNoTopologies}
+	}
+	return topologies, nil
+}
+
+// Names returns the names of the topologies.
+func (ts Topologies) Names() []string {
+	names := make([]string, 0, len(ts))
+	for _, nt := range ts {
+		names = append(names, nt.Name)
+	}
+	return names
+}
+
+// Default returns the cluster default topology: the first one with
+// ClusterDefault, or the first one if none has it. It may be flat.
+func (ts Topologies) Default() *NamedTopology {
+	for i := range ts {
+		if ts[i].ClusterDefault {
+			return &ts[i]
+		}
+	}
+	return &ts[0]
+}
+
+// Find returns the topology called name, the cluster default if name is
+// empty. It fails with ErrFlatTopology if that topology is flat.
+func (ts Topologies) Find(name string) (*NamedTopology, error) {
+	if name == "" {
+		nt := ts.Default()
+		if nt.Flat {
+			return nil, fmt.Errorf("%w: %s, the cluster default", ErrFlatTopology, nt.Name)
+		}
+		return nt, nil
+	}
+	for i := range ts {
+		if ts[i].Name != name {
+			continue
+		}
+		if ts[i].Flat {
+			return nil, fmt.Errorf("%w: %s", ErrFlatTopology, name)
+		}
+		return &ts[i], nil
+	}
+	return nil, fmt.Errorf("%w: %s, expected one of %s", ErrUnknownTopology, name, strings.Join(ts.Names(), ", "))
+}
+
+// ForPartition returns the topology of a partition, given the topology of
+// each partition as LoadPartitionTopologies returns.
+func (ts Topologies) ForPartition(partitions map[string]string, partition string) (*NamedTopology, error) {
+	name, ok := partitions[partition]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPartition, partition)
+	}
+	nt, err := ts.Find(name)
+	if err != nil {
+		return nil, fmt.Errorf("partition %s: %w", partition, err)
+	}
+	return nt, nil
+}
+
+// WriteYAML writes the topologies as a topology.yaml file that loads into
+// the same switch or block records. Switches are written in the order of
+// WriteConfig.
+func (ts Topologies) WriteYAML(w io.Writer) error {
+	entries := make([]*yaml_topology_t, 0, len(ts))
+	for _, nt := range ts {
+		t := nt.Topology
+		e := &yaml_topology_t{Topology: nt.Name, ClusterDefault: nt.ClusterDefault}
+		if nt.Flat {
+			e.Flat = true
+		} else if t.plugin == PluginBlock {
+			e.Block = &yaml_blocks_t{BlockSizes: t.BlockSizes(), Blocks: []*yaml_block_t{}}
+			for _, block_ptr := range t.block_record_table {
+				e.Block.Blocks = append(e.Block.Blocks, &yaml_block_t{
+					Block: block_ptr.name,
+					Nodes: t.bitmap2node_name(block_ptr.node_bitmap),
+				})
+			}
+		} else {
+			e.Tree = &yaml_tree_t{Switches: []*yaml_switch_t{}}
+			for _, switch_ptr := range t._switches_by_level() {
+				sw := &yaml_switch_t{Switch: switch_ptr.name, LinkSpeed: switch_ptr.link_speed}
+				if switch_ptr.level == 0 {
+					sw.Nodes = t.bitmap2node_name(switch_ptr.node_bitmap)
+				} else {
+					sw.Children = t._child_switches(switch_ptr)
+				}
+				e.Tree.Switches = append(e.Tree.Switches, sw)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(entries); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,144 @@
+package tree
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadYAML(t *testing.T) {
+	topologies, err := LoadYAML("../../../../test/topology.yaml")
+	require.NoError(t, err)
+	require.Equal(t, []string{"cpu", "gpu", "login"}, topologies.Names())
+	require.True(t, topologies[2].Flat)
+	require.Nil(t, topologies[2].Topology)
+
+	cpu, gpu := topologies[0].Topology, topologies[1].Topology
+	require.Equal(t, PluginTree, cpu.Plugin())
+	require.Len(t, cpu.Nodes(), 16)
+	require.Equal(t, uint32(1800), cpu.Switches()[3].LinkSpeed)
+	require.Equal(t, []string{"s0", "s1", "s2", "s3"}, cpu.Switches()[4].Switches)
+	require.Equal(t, PluginBlock, gpu.Plugin())
+	require.Equal(t, []int{18, 36, 72}, gpu.BlockSizes())
+
+	nt, err := topologies.Find("")
+	require.NoError(t, err)
+	require.Equal(t, "cpu", nt.Name)
+	_, err = topologies.Find("login")
+	require.ErrorIs(t, err, ErrFlatTopology)
+	require.EqualError(t, err, "topology is flat, it has no switches: login")
+	_, err = topologies.Find("batch")
+	require.ErrorIs(t, err, ErrUnknownTopology)
+
+	partitions, err := LoadPartitionTopologies("../../../../test/slurm.conf")
+	require.NoError(t, err)
+	nt, err = topologies.ForPartition(partitions, "gpu")
+	require.NoError(t, err)
+	require.Same(t, gpu, nt.Topology)
+	nt, err = topologies.ForPartition(partitions, "debug")
+	require.NoError(t, err)
+	require.Same(t, cpu, nt.Topology)
+	_, err = topologies.ForPartition(partitions, "login")
+	require.ErrorIs(t, err, ErrFlatTopology)
+	_, err = topologies.ForPartition(partitions, "batch")
+	require.ErrorIs(t, err, ErrUnknownPartition)
+}
+
+func TestLoadYAML_flatDefault(t *testing.T) {
+	topologies, err := LoadYAML("../../../../test/topology-flat.yaml")
+	require.NoError(t, err)
+	require.Equal(t, []string{"login", "cpu"}, topologies.Names())
+
+	/* The flat default is reported, not replaced by another topology */
+	def := topologies.Default()
+	require.Equal(t, "login", def.Name)
+	require.True(t, def.Flat)
+	_, err = topologies.Find("")
+	require.ErrorIs(t, err, ErrFlatTopology)
+	require.EqualError(t, err, "topology is flat, it has no switches: login, the cluster default")
+	_, err = topologies.ForPartition(map[string]string{"debug": ""}, "debug")
+	require.ErrorIs(t, err, ErrFlatTopology)
+
+	nt, err := topologies.Find("cpu")
+	require.NoError(t, err)
+	require.Len(t, nt.Topology.Nodes(), 16)
+
+	/* Flat topologies are written back */
+	var buf bytes.Buffer
+	require.NoError(t, topologies.WriteYAML(&buf))
+	require.True(t, strings.HasPrefix(buf.String(), "- topology: login\n  cluster_default: true\n  flat: true\n"), buf.String())
+	reloaded, err := LoadYAMLReader(&buf, "inline.yaml")
+	require.NoError(t, err)
+	require.Equal(t, topologies.Names(), reloaded.Names())
+	require.True(t, reloaded[0].Flat)
+}
+
+func TestLoadYAMLReader_errors(t *testing.T) {
+	for _, tc := range []struct {
+		yaml string
+		err  error
+		msg  string
+	}{
+		{"", ErrNoTopologies, "inline.yaml: no topologies configured"},
+		{"- topology: a\n  tree:\n    switches:\n      - switch: s0\n        node: tux0\n",
+			ErrSyntax, `line 5: unknown key "node"`},
+		{"- topology: a\n  flat: true\n  block:\n    blocks: []\n", ErrSyntax, "must define one of tree, block or flat"},
+		{"- topology: a\n  flat: true\n- topology: a\n  flat: true\n", ErrDuplicateTopology, "inline.yaml:3"},
+		{"- topology: a\n  tree:\n    switches:\n      - switch: s0\n        children: s1\n",
+			ErrUnknownChild, "topology a: inline.yaml:4: switch s0"},
+		{"- topology: a\n  tree:\n    switches:\n      - switch: s0\n", ErrNoSwitches, "topology a"},
+	} {
+		_, err := LoadYAMLReader(strings.NewReader(tc.yaml), "inline.yaml")
+		require.ErrorIs(t, err, tc.err, tc.yaml)
+		require.Contains(t, err.Error(), tc.msg)
+	}
+}
+
+func TestTopologies_WriteYAML(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+	block, err := Load("../../../../test/block1.conf")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Topologies{
+		{Name: "tree", ClusterDefault: true, Topology: topo},
+		{Name: "block", Topology: block},
+	}.WriteYAML(&buf))
+	require.True(t, strings.HasPrefix(buf.String(), `- topology: tree
+  cluster_default: true
+  tree:
+    switches:
+      - switch: s0
+        nodes: tu-x[0-1]
+`), buf.String())
+	require.Contains(t, buf.String(), `      - switch: s6
+        children: s[4-5]
+- topology: block
+  cluster_default: false
+  block:
+    block_sizes:
+      - 18
+      - 36
+      - 72
+    blocks:
+      - block: b1
+        nodes: gb200-[001-018]
+`)
+
+	/* Both ways, conf to yaml and yaml to conf, keep the records */
+	topologies, err := LoadYAMLReader(&buf, "inline.yaml")
+	require.NoError(t, err)
+	require.ElementsMatch(t, topo.Switches(), topologies[0].Topology.Switches())
+	require.Equal(t, block.Blocks(), topologies[1].Topology.Blocks())
+
+	topologies, err = LoadYAML("../../../../test/topology.yaml")
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, topologies[0].Topology.WriteConfig(&buf))
+	reloaded, err := LoadReader(&buf, "inline.conf")
+	require.NoError(t, err)
+	require.ElementsMatch(t, topologies[0].Topology.Switches(), reloaded.Switches())
+}
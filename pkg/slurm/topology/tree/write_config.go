@@ -0,0 +1,112 @@
+package tree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yeahdongcn/topology/pkg/slurm/hostlist"
+)
+
+type write_options_t struct {
+	comments bool
+}
+
+// WriteOption configures how a topology configuration is written.
+type WriteOption func(*write_options_t)
+
+// WithComments makes WriteConfig describe each group of lines in comments.
+func WithComments() WriteOption {
+	return func(o *write_options_t) {
+		o.comments = true
+	}
+}
+
+// WriteConfig writes the topology as a topology configuration file that
+// loads into the same switch or block records. Hostlists are compressed.
+// Switches are written leaves first, then by level, in configuration order
+// within a level. Blocks are written in configuration order, followed by
+// their BlockSizes.
+func (t *Topology) WriteConfig(w io.Writer, opts ...WriteOption) error {
+	o := &write_options_t{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	bw := bufio.NewWriter(w)
+	if t.plugin == PluginBlock {
+		t._write_blocks(bw, o)
+	} else {
+		t._write_switches(bw, o)
+	}
+	return bw.Flush()
+}
+
+/* Return the switches leaves first, then by level, in configuration order */
+func (t *Topology) _switches_by_level() []*switch_record_t {
+	order := make([]*switch_record_t, 0, t.switch_record_cnt)
+	order = append(order, t.switch_record_table...)
+	slices.SortStableFunc(order, func(a, b *switch_record_t) int {
+		return a.level - b.level
+	})
+	return order
+}
+
+/* Return the hostlist expression of the direct descendant switches */
+func (t *Topology) _child_switches(switch_ptr *switch_record_t) string {
+	names := make([]string, 0, switch_ptr.num_switches)
+	for _, child := range switch_ptr.switch_index {
+		names = append(names, t.switch_record_table[child].name)
+	}
+	return hostlist.Compress(names)
+}
+
+/* Write the SwitchName lines of a topology/tree topology */
+func (t *Topology) _write_switches(w *bufio.Writer, o *write_options_t) {
+	order := t._switches_by_level()
+	for i, switch_ptr := range order {
+		if o.comments && (i == 0 || order[i-1].level != switch_ptr.level) {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if switch_ptr.level == 0 {
+				fmt.Fprintln(w, "# Leaf switches")
+			} else {
+				fmt.Fprintf(w, "# Level %d switches\n", switch_ptr.level)
+			}
+		}
+
+		fmt.Fprintf(w, "SwitchName=%s", switch_ptr.name)
+		if switch_ptr.level == 0 {
+			fmt.Fprintf(w, " Nodes=%s", t.bitmap2node_name(switch_ptr.node_bitmap))
+		} else {
+			fmt.Fprintf(w, " Switches=%s", t._child_switches(switch_ptr))
+		}
+		if switch_ptr.link_speed != 0 {
+			fmt.Fprintf(w, " LinkSpeed=%d", switch_ptr.link_speed)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+/* Write the BlockName and BlockSizes lines of a topology/block topology */
+func (t *Topology) _write_blocks(w *bufio.Writer, o *write_options_t) {
+	if o.comments {
+		fmt.Fprintf(w, "# Base blocks of %d nodes\n", t.bblock_node_cnt)
+	}
+	for _, block_ptr := range t.block_record_table {
+		fmt.Fprintf(w, "BlockName=%s Nodes=%s\n", block_ptr.name, t.bitmap2node_name(block_ptr.node_bitmap))
+	}
+
+	sizes := make([]string, 0, len(t.block_sizes))
+	for _, size := range t.BlockSizes() {
+		sizes = append(sizes, strconv.Itoa(size))
+	}
+	if o.comments {
+		fmt.Fprintln(w, "\n# Node counts of the block aggregations a job can be placed in")
+	}
+	fmt.Fprintf(w, "BlockSizes=%s\n", strings.Join(sizes, ","))
+}
@@ -0,0 +1,67 @@
+package tree
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopology_WriteConfig(t *testing.T) {
+	topo, err := Load("../../../../test/topology1.conf")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, topo.WriteConfig(&buf))
+	require.Equal(t, `SwitchName=s0 Nodes=tu-x[0-1]
+SwitchName=s1 Nodes=tu-x[2-3]
+SwitchName=s2 Nodes=tux[4-5]
+SwitchName=s3 Nodes=tux[6-7]
+SwitchName=s4 Switches=s[0-1]
+SwitchName=s5 Switches=s[2-3]
+SwitchName=s6 Switches=s[4-5]
+`, buf.String())
+
+	/* Leaves come first, whatever the configuration order */
+	topo, err = LoadReader(bytes.NewBufferString(`SwitchName=top Switches=leaf[0-1] LinkSpeed=1800
+SwitchName=leaf1 Nodes=tux[2-3]
+SwitchName=leaf0 Nodes=tux1,tux0 LinkSpeed=900
+`), "inline.conf")
+	require.NoError(t, err)
+	buf.Reset()
+	require.NoError(t, topo.WriteConfig(&buf, WithComments()))
+	require.Equal(t, `# Leaf switches
+SwitchName=leaf1 Nodes=tux[2-3]
+SwitchName=leaf0 Nodes=tux[0-1] LinkSpeed=900
+
+# Level 1 switches
+SwitchName=top Switches=leaf[0-1] LinkSpeed=1800
+`, buf.String())
+}
+
+func TestTopology_WriteConfig_roundTrip(t *testing.T) {
+	filenames, err := filepath.Glob("../../../../test/*.conf")
+	require.NoError(t, err)
+	for _, filename := range filenames {
+		if filepath.Base(filename) == "slurm.conf" {
+			continue
+		}
+		t.Run(filepath.Base(filename), func(t *testing.T) {
+			topo, err := Load(filename)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, topo.WriteConfig(&buf, WithComments()))
+			reloaded, err := LoadReader(&buf, filename)
+			require.NoError(t, err)
+			require.Empty(t, reloaded.Diagnostics())
+
+			require.Equal(t, topo.Plugin(), reloaded.Plugin())
+			require.Equal(t, topo.Nodes(), reloaded.Nodes())
+			require.ElementsMatch(t, topo.Switches(), reloaded.Switches())
+			require.Equal(t, topo.Blocks(), reloaded.Blocks())
+			require.Equal(t, topo.BlockSizes(), reloaded.BlockSizes())
+		})
+	}
+}